@@ -0,0 +1,271 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/fiurgeist/golox/internal/ast/stmt"
+	"github.com/fiurgeist/golox/internal/core"
+	"github.com/fiurgeist/golox/internal/interpreter"
+	"github.com/fiurgeist/golox/internal/reporter"
+	"github.com/fiurgeist/golox/internal/token"
+	"github.com/fiurgeist/golox/internal/vm"
+)
+
+// result is what a script printed and the message of the runtime error it failed with, if any.
+type result struct {
+	output string
+	err    string
+}
+
+// backends run a script with an allocation limit, 0 for none. The tree-walking interpreter is the
+// reference for the others.
+var backends = map[string]func(t *testing.T, source *token.Source, maxAllocation int) result{
+	"tree": func(t *testing.T, source *token.Source, maxAllocation int) result {
+		return runInterpreter(t, source, interpreter.WithMaxAllocation(maxAllocation))
+	},
+	"closure": func(t *testing.T, source *token.Source, maxAllocation int) result {
+		return runInterpreter(t, source, interpreter.WithMaxAllocation(maxAllocation), interpreter.WithClosureCompilation())
+	},
+	"vm": func(t *testing.T, source *token.Source, maxAllocation int) result {
+		reporter := reporter.NewCollector()
+		function, err := compile(parseAndResolve(t, source, reporter), reporter)
+		if err != nil {
+			t.Fatalf("compiling %s: %v", source.Path, reporter.Diagnostics)
+		}
+
+		var output bytes.Buffer
+		vm := vm.NewVM(reporter, vm.WithPath(source.Path), vm.WithOutput(&output), vm.WithMaxAllocation(maxAllocation))
+		vm.Interpret(function)
+
+		return newResult(output, reporter)
+	},
+}
+
+// TestBackends runs every example with every backend, they have to print the same as the
+// tree-walking interpreter.
+func TestBackends(t *testing.T) {
+	paths, err := filepath.Glob("../../examples/*.lox")
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no examples found: %v", err)
+	}
+
+	for _, path := range paths {
+		code, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		source := &token.Source{Path: path, Code: code}
+
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			want := backends["tree"](t, source, 0)
+			want.output = maskClock(want.output)
+
+			for name, runBackend := range backends {
+				got := runBackend(t, source, 0)
+				if got.output = maskClock(got.output); got != want {
+					t.Errorf("%s returned\n%+v\nthe tree-walking interpreter returned\n%+v", name, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestBackendsScripts runs scripts the examples don't cover with every backend.
+func TestBackendsScripts(t *testing.T) {
+	tests := []struct {
+		name          string
+		code          string
+		maxAllocation int
+		want          result
+	}{
+		{
+			name: "NaN map key",
+			code: `var m = {}; m[0/0] = 1;`,
+			want: result{err: "Unhashable map key NaN"},
+		},
+		{
+			name: "caught NaN map key",
+			code: `try { has({}, 0/0); } catch (e) { print e.message; }`,
+			want: result{output: "Unhashable map key NaN\n"},
+		},
+		{
+			name: "runtime error through finally",
+			code: `try { nil.x; } finally { print "finally"; }`,
+			want: result{output: "finally\n", err: "'nil' is not an instance"},
+		},
+		{
+			name: "rethrown runtime error",
+			code: `try { nil.x; } catch (e) { print e.message; throw e; } finally { print "finally"; }`,
+			want: result{output: "'nil' is not an instance\nfinally\n", err: "'nil' is not an instance"},
+		},
+		{
+			name: "more than 256 locals",
+			code: "fun f() {" + repeat(300, "var a%d = %[1]d;") + "print a0 + a299; } f();",
+			want: result{output: "299\n"},
+		},
+		{
+			name: "more than 256 upvalues",
+			code: "fun f() {" + repeat(300, "var a%d = 1;") +
+				"fun g() { a299 = 2; return 0" + repeat(300, " + a%d") + "; } print g(); } f();",
+			want: result{output: "301\n"},
+		},
+		{
+			name: "more than 65536 constants",
+			code: "var s = 0;" + repeat(70000, "s = s + %d;") + "print s == 2449965000;",
+			want: result{output: "true\n"},
+		},
+		{
+			name: "jumps over more than 64K of code",
+			code: "var s = 0; while (s < 1) { if (true) {" + strings.Repeat("s = s + 1;", 20000) + "} } print s;",
+			want: result{output: "20000\n"},
+		},
+		{
+			name: "deeply nested expressions in every call",
+			code: "fun r(n) { return " + strings.Repeat("1 + (", 16) + "r(n)" + strings.Repeat(")", 16) + "; } r(0);",
+			want: result{err: "Stack overflow"},
+		},
+		{
+			name:          "string allocation limit",
+			code:          `var s = "x"; while (true) s = s + s;`,
+			maxAllocation: 10000,
+			want:          result{err: "Allocation limit of 10000 bytes exceeded"},
+		},
+		{
+			name:          "caught allocation limit",
+			code:          `var l = []; try { while (true) push(l, [1, 2]); } catch (e) { print e.message; } print len(l) > 100;`,
+			maxAllocation: 10000,
+			want:          result{output: "Allocation limit of 10000 bytes exceeded\ntrue\n"},
+		},
+		{
+			name:          "interpolation allocation limit",
+			code:          `var s = "x"; while (true) s = "${s}${s}";`,
+			maxAllocation: 10000,
+			want:          result{err: "Allocation limit of 10000 bytes exceeded"},
+		},
+		{
+			name:          "instance allocation limit",
+			code:          `class A {} var a = A(); var i = 0; while (true) { a = A(); a.f = {"i": i}; i = i + 1; }`,
+			maxAllocation: 10000,
+			want:          result{err: "Allocation limit of 10000 bytes exceeded"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			source := &token.Source{Code: []byte(test.code)}
+			for name, runBackend := range backends {
+				if got := runBackend(t, source, test.maxAllocation); got != test.want {
+					t.Errorf("%s returned %+v, want %+v", name, got, test.want)
+				}
+			}
+		})
+	}
+}
+
+// TestBackendsEntryScriptInCycle imports the entry script from a file it imports, its top-level code
+// mustn't run again.
+func TestBackendsEntryScriptInCycle(t *testing.T) {
+	path := "../../examples/modules/cycle_main.lox"
+	code, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := &token.Source{Path: path, Code: code}
+
+	main, err := filepath.Abs(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	back := filepath.Join(filepath.Dir(main), "sub", "cycle_back.lox")
+	want := result{
+		output: "main runs\n",
+		err:    fmt.Sprintf("Cyclic import %s -> %s -> %[1]s", core.DisplayPath(main), core.DisplayPath(back)),
+	}
+
+	for name, runBackend := range backends {
+		if got := runBackend(t, source, 0); got != want {
+			t.Errorf("%s returned %+v, want %+v", name, got, want)
+		}
+	}
+}
+
+// TestSharedGlobals runs inputs in the same global environment with an interpreter each, like the
+// REPL does. Globals shadowing natives must keep their values.
+func TestSharedGlobals(t *testing.T) {
+	environment := interpreter.NewEnvironment()
+	inputs := []string{`var keys = 5;`, `print keys;`, `fun len(x) { return "own"; }`, `print len([]);`, `print has({}, 1);`}
+
+	var output bytes.Buffer
+	for _, input := range inputs {
+		reporter := reporter.NewCollector()
+		statements := parseAndResolve(t, &token.Source{Code: []byte(input)}, reporter)
+		interpreter := interpreter.NewInterpreter(environment, reporter, interpreter.WithOutput(&output))
+		if err := interpreter.Interpret(statements); err != nil {
+			t.Fatalf("running %q: %v", input, reporter.Diagnostics)
+		}
+	}
+
+	if want := "5\nown\nfalse\n"; output.String() != want {
+		t.Errorf("printed %q, want %q", output.String(), want)
+	}
+}
+
+// repeat concatenates format formatted with 0 to n-1.
+func repeat(n int, format string) string {
+	var b strings.Builder
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&b, format, i)
+	}
+
+	return b.String()
+}
+
+func runInterpreter(t *testing.T, source *token.Source, options ...interpreter.Option) result {
+	reporter := reporter.NewCollector()
+	statements := parseAndResolve(t, source, reporter)
+
+	var output bytes.Buffer
+	options = append(options, interpreter.WithPath(source.Path), interpreter.WithOutput(&output))
+	interpreter := interpreter.NewInterpreter(interpreter.NewEnvironment(), reporter, options...)
+	interpreter.Interpret(statements)
+
+	return newResult(output, reporter)
+}
+
+func newResult(output bytes.Buffer, collector *reporter.Collector) result {
+	result := result{output: output.String()}
+	for _, diagnostic := range collector.Diagnostics {
+		if diagnostic.Phase == reporter.PhaseRuntime {
+			result.err = diagnostic.Message
+		}
+	}
+
+	return result
+}
+
+func parseAndResolve(t *testing.T, source *token.Source, reporter reporter.ErrorReporter) []stmt.Stmt {
+	statements, err := parse(source, reporter)
+	if err != nil {
+		t.Fatalf("parsing %s: %s", source.Path, err)
+	}
+
+	if err := resolve(statements, reporter); err != nil {
+		t.Fatalf("resolving %s: %s", source.Path, err)
+	}
+
+	return statements
+}
+
+// clockOutput matches what the examples print of clock(), a timestamp in milliseconds or the time
+// a loop took.
+var clockOutput = regexp.MustCompile(`(?m)^\d\.\d+e\+12$|^took:\n.*$`)
+
+func maskClock(output string) string {
+	return clockOutput.ReplaceAllString(output, "<clock>")
+}
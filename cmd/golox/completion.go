@@ -0,0 +1,79 @@
+package main
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/fiurgeist/golox/internal/interpreter"
+	"github.com/fiurgeist/golox/internal/token"
+)
+
+// complete offers keywords and globals, or the properties of an object after a '.'.
+func complete(head string) (int, []string) {
+	start := len(head)
+	for start > 0 && isIdentifierChar(head[start-1]) {
+		start--
+	}
+	word := head[start:]
+
+	var names []string
+	if start > 0 && head[start-1] == '.' {
+		names = properties(head[:start-1])
+	} else {
+		for keyword := range token.Keywords {
+			names = append(names, keyword)
+		}
+		names = append(names, interpreter.NativeNames()...)
+		names = append(names, environment.Names()...)
+	}
+
+	var candidates []string
+	for _, name := range names {
+		if strings.HasPrefix(name, word) {
+			candidates = append(candidates, name)
+		}
+	}
+	sort.Strings(candidates)
+
+	// globals can shadow natives
+	return start, slices.Compact(candidates)
+}
+
+// properties of the object at the end of head, if it's a global or a chain of properties
+// starting at a global like "a.b", nothing else is evaluated.
+func properties(head string) []string {
+	start := len(head)
+	for start > 0 && (isIdentifierChar(head[start-1]) || head[start-1] == '.') {
+		start--
+	}
+
+	path := strings.Split(head[start:], ".")
+	value, ok := environment.Get(path[0])
+	if !ok {
+		return nil
+	}
+
+	for _, name := range path[1:] {
+		object, ok := value.(interpreter.Object)
+		if !ok || !contains(object.Properties(), name) {
+			return nil
+		}
+		value = object.Get(token.Token{Lexeme: name})
+	}
+
+	if object, ok := value.(interpreter.Object); ok {
+		return object.Properties()
+	}
+
+	return nil
+}
+
+func contains(names []string, name string) bool {
+	i := sort.SearchStrings(names, name)
+	return i < len(names) && names[i] == name
+}
+
+func isIdentifierChar(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
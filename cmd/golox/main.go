@@ -1,17 +1,24 @@
 package main
 
 import (
-	"bufio"
+	"context"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
 	"os"
+	"os/signal"
 	"time"
 
+	"github.com/fiurgeist/golox/internal/ast/printer"
+	"github.com/fiurgeist/golox/internal/ast/stmt"
+	"github.com/fiurgeist/golox/internal/compiler"
 	"github.com/fiurgeist/golox/internal/interpreter"
 	"github.com/fiurgeist/golox/internal/lexer"
 	"github.com/fiurgeist/golox/internal/parser"
 	"github.com/fiurgeist/golox/internal/reporter"
 	"github.com/fiurgeist/golox/internal/resolver"
+	"github.com/fiurgeist/golox/internal/token"
+	"github.com/fiurgeist/golox/internal/vm"
 )
 
 // https://man.freebsd.org/cgi/man.cgi?query=sysexits
@@ -19,65 +26,293 @@ const (
 	EX_OK       = 0
 	EX_USAGE    = 64
 	EX_DATAERR  = 65
+	EX_NOINPUT  = 66
 	EX_SOFTWARE = 70
 )
 
-const DEBUG = false
+const usage = `Usage: golox [flags] [command] [script] [arguments...]
+
+Commands:
+  run <script> [arguments...]  run the script, the default if a script is given
+  repl                         start an interactive prompt, the default without a script
+  check <script>               lex, parse and resolve the script without running it
+  tokens <script>              print the tokens of the script
+  ast <script>                 print the syntax tree of the script
+  bytecode <script>            print the instructions the script is compiled to for the vm backend
+
+The script can be given as code with -e instead of a file.
+Arguments after the script are returned by the native args().
+
+Flags:
+`
+
+var commands = map[string]bool{"run": true, "repl": true, "check": true, "tokens": true, "ast": true, "bytecode": true}
 
-var PERF = false
 var environment = interpreter.NewEnvironment()
 
+var code = flag.String("e", "", "code to use as the script")
+var timing = flag.Bool("time", false, "print the time each phase took")
+var maxCallDepth = flag.Int("max-call-depth", interpreter.DefaultMaxCallDepth, "maximum number of nested calls")
+var warningsAsErrors = flag.Bool("Werror", false, "report warnings as errors")
+var noUnusedWarning = flag.Bool("Wno-unused", false, "don't warn about unused local variables")
+var maxSteps = flag.Int("max-steps", 0, "maximum number of executed statements and evaluated expressions, or bytecode instructions with --backend=vm, 0 for no limit")
+var timeout = flag.Duration("timeout", 0, "maximum time the script may run, like 500ms or 2s, 0 for no limit")
+var maxAllocation = flag.Int("max-allocation", 0, "maximum number of bytes the script may allocate in total, approximately, 0 for no limit")
+var diagnostics = flag.String("diagnostics", "text", "diagnostics format: text or json (written to stderr)")
+var backend = flag.String("backend", "tree", "how scripts are run: tree (walking the syntax tree), closure (compiled to Go closures) or vm (compiled to bytecode)")
+
 func main() {
-	if len(os.Args) > 2 {
-		fmt.Print("Usage: golox [script]\n")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	args := flag.Args()
+	command := "run"
+	if len(args) != 0 && commands[args[0]] {
+		command = args[0]
+		// flags may also follow the command
+		flag.CommandLine.Parse(args[1:])
+		args = flag.Args()
+	} else if len(args) == 0 && *code == "" {
+		command = "repl"
+	}
+
+	if *diagnostics != "text" && *diagnostics != "json" {
+		exitUsage()
+	}
+
+	if *backend != "tree" && *backend != "closure" && *backend != "vm" {
+		exitUsage()
+	}
+
+	if *maxCallDepth < 1 {
+		fmt.Fprintln(os.Stderr, "-max-call-depth must be at least 1")
 		os.Exit(EX_USAGE)
 	}
 
-	if len(os.Args) == 1 {
+	if command == "repl" {
+		if len(args) != 0 || *code != "" {
+			exitUsage()
+		}
+		if *backend == "vm" {
+			fmt.Fprintln(os.Stderr, "the REPL is not supported by the vm backend, use --backend=tree or --backend=closure")
+			os.Exit(EX_USAGE)
+		}
 		runPrompt()
 		return
 	}
 
-	path := os.Args[1]
-	runFile(path)
+	source, args := script(args)
+	if command != "run" && len(args) != 0 {
+		exitUsage()
+	}
+
+	switch command {
+	case "run":
+		os.Exit(run(source, args))
+	case "check":
+		os.Exit(check(source))
+	case "tokens":
+		os.Exit(printTokens(source))
+	case "ast":
+		os.Exit(printAst(source))
+	case "bytecode":
+		os.Exit(printBytecode(source))
+	}
 }
 
-func run(script []byte) int {
-	reporter := &reporter.ConsoleReporter{}
-	lexer := lexer.NewLexer(script, reporter)
+func exitUsage() {
+	flag.Usage()
+	os.Exit(EX_USAGE)
+}
+
+// script is either the code given with -e or the file given as first argument,
+// the remaining arguments are returned.
+func script(args []string) (*token.Source, []string) {
+	if *code != "" {
+		return &token.Source{Code: []byte(*code)}, args
+	}
+
+	if len(args) == 0 {
+		exitUsage()
+	}
+
+	file, err := os.ReadFile(args[0])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(EX_NOINPUT)
+	}
+
+	return &token.Source{Path: args[0], Code: file}, args[1:]
+}
+
+func newReporter() reporter.ErrorReporter {
+	if *diagnostics == "json" {
+		return reporter.NewJSONReporter(os.Stderr)
+	}
+
+	return &reporter.ConsoleReporter{}
+}
+
+func resolverOptions() []resolver.Option {
+	var options []resolver.Option
+	if *warningsAsErrors {
+		options = append(options, resolver.WithWarningsAsErrors())
+	}
+	if *noUnusedWarning {
+		options = append(options, resolver.WithoutWarning(resolver.WarnUnused))
+	}
+
+	return options
+}
+
+func lex(source *token.Source, reporter reporter.ErrorReporter) ([]token.Token, error) {
+	lexer := lexer.NewLexer(source, reporter)
 
 	start := time.Now().UnixNano()
-	tokens, errLex := lexer.ScanTokens()
+	tokens, err := lexer.ScanTokens()
 	printPerf("Lexing", start)
 
-	if DEBUG {
-		for _, token := range tokens {
-			fmt.Println(token.String())
-		}
-	}
+	return tokens, err
+}
+
+func parse(source *token.Source, reporter reporter.ErrorReporter) ([]stmt.Stmt, error) {
+	tokens, errLex := lex(source, reporter)
 
 	parser := parser.NewParser(tokens, reporter)
 
-	start = time.Now().UnixNano()
+	start := time.Now().UnixNano()
 	statements, errParse := parser.Parse()
 	printPerf("Parsing", start)
 
-	if errLex != nil || errParse != nil || reporter.HadError {
-		return EX_DATAERR
+	if errLex != nil {
+		return statements, errLex
+	}
+
+	return statements, errParse
+}
+
+func newInterpreter(
+	source *token.Source,
+	reporter reporter.ErrorReporter,
+	args []string,
+	options ...interpreter.Option,
+) interpreter.Interpreter {
+	options = append(
+		options,
+		interpreter.WithPath(source.Path),
+		interpreter.WithArgs(args),
+		interpreter.WithMaxCallDepth(*maxCallDepth),
+		interpreter.WithResolverOptions(resolverOptions()...),
+	)
+	if *maxSteps > 0 {
+		options = append(options, interpreter.WithMaxSteps(*maxSteps))
+	}
+	if *timeout > 0 {
+		options = append(options, interpreter.WithTimeout(*timeout))
+	}
+	if *maxAllocation > 0 {
+		options = append(options, interpreter.WithMaxAllocation(*maxAllocation))
+	}
+	if *backend == "closure" {
+		options = append(options, interpreter.WithClosureCompilation())
+	}
+
+	return interpreter.NewInterpreter(environment, reporter, options...)
+}
+
+func newVM(source *token.Source, reporter reporter.ErrorReporter, args []string, options ...vm.Option) vm.VM {
+	options = append(
+		options,
+		vm.WithPath(source.Path),
+		vm.WithArgs(args),
+		vm.WithMaxCallDepth(*maxCallDepth),
+		vm.WithResolverOptions(resolverOptions()...),
+	)
+	if *maxSteps > 0 {
+		options = append(options, vm.WithMaxSteps(*maxSteps))
+	}
+	if *timeout > 0 {
+		options = append(options, vm.WithTimeout(*timeout))
+	}
+	if *maxAllocation > 0 {
+		options = append(options, vm.WithMaxAllocation(*maxAllocation))
 	}
 
-	interpreter := interpreter.NewInterpreter(environment, reporter)
-	resolver := resolver.NewResolver(interpreter, reporter)
+	return vm.NewVM(reporter, options...)
+}
+
+var errInterrupted = errors.New("interrupted")
 
-	start = time.Now().UnixNano()
-	resolver.Resolve(statements)
+// interruptible returns a context cancelled by Ctrl-C, which then stops the execution instead of
+// the process. The returned function restores the default handling of Ctrl-C.
+func interruptible() (context.Context, func()) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	go func() {
+		if _, ok := <-interrupt; ok {
+			cancel(errInterrupted)
+		}
+	}()
+
+	return ctx, func() {
+		signal.Stop(interrupt)
+		close(interrupt)
+		cancel(nil)
+	}
+}
+
+func resolve(statements []stmt.Stmt, reporter reporter.ErrorReporter) error {
+	resolver := resolver.NewResolver(reporter, resolverOptions()...)
+
+	start := time.Now().UnixNano()
+	err := resolver.Resolve(statements)
 	printPerf("Resolveing", start)
 
-	if reporter.HadError {
+	return err
+}
+
+func compile(statements []stmt.Stmt, reporter reporter.ErrorReporter) (*compiler.Function, error) {
+	compiler := compiler.NewCompiler(reporter)
+
+	start := time.Now().UnixNano()
+	function, err := compiler.Compile(statements)
+	printPerf("Compiling", start)
+
+	return function, err
+}
+
+func run(source *token.Source, args []string) int {
+	reporter := newReporter()
+
+	statements, err := parse(source, reporter)
+	if err != nil {
 		return EX_DATAERR
 	}
 
-	start = time.Now().UnixNano()
+	return execute(source, statements, reporter, args)
+}
+
+// execute resolves and interprets the parsed statements.
+func execute(source *token.Source, statements []stmt.Stmt, reporter reporter.ErrorReporter, args []string) int {
+	if err := resolve(statements, reporter); err != nil {
+		return EX_DATAERR
+	}
+
+	if *backend == "vm" {
+		return executeVM(source, statements, reporter, args)
+	}
+
+	ctx, stop := interruptible()
+	defer stop()
+
+	interpreter := newInterpreter(source, reporter, args, interpreter.WithContext(ctx))
+
+	start := time.Now().UnixNano()
 	err := interpreter.Interpret(statements)
 	printPerf("Interpreting", start)
 
@@ -88,45 +323,99 @@ func run(script []byte) int {
 	return EX_OK
 }
 
-func runPrompt() {
-	scanner := bufio.NewScanner(os.Stdin)
-	fmt.Println("Lox REPL")
+// executeVM compiles the resolved statements and runs the bytecode.
+func executeVM(source *token.Source, statements []stmt.Stmt, reporter reporter.ErrorReporter, args []string) int {
+	function, err := compile(statements, reporter)
+	if err != nil {
+		return EX_DATAERR
+	}
 
-	for {
-		fmt.Print("> ")
+	ctx, stop := interruptible()
+	defer stop()
 
-		scanner.Scan()
-		err := scanner.Err()
-		if err != nil {
-			log.Fatal(err)
-		}
+	vm := newVM(source, reporter, args, vm.WithContext(ctx))
+
+	start := time.Now().UnixNano()
+	err = vm.Interpret(function)
+	printPerf("Interpreting", start)
+
+	if err != nil {
+		return EX_SOFTWARE
+	}
+
+	return EX_OK
+}
+
+func check(source *token.Source) int {
+	reporter := newReporter()
+
+	statements, err := parse(source, reporter)
+	if err != nil {
+		return EX_DATAERR
+	}
+
+	if err := resolve(statements, reporter); err != nil {
+		return EX_DATAERR
+	}
 
-		line := scanner.Text()
-		if line == "" {
-			// the typical Ctrl-D to exit will cause an empty line -> break
-			fmt.Println("")
-			break
+	if *backend == "vm" {
+		if _, err := compile(statements, reporter); err != nil {
+			return EX_DATAERR
 		}
+	}
+
+	return EX_OK
+}
+
+func printTokens(source *token.Source) int {
+	tokens, err := lex(source, newReporter())
+
+	for _, token := range tokens {
+		fmt.Printf("%d:%d %s\n", token.Line, token.Column, token.String())
+	}
+
+	if err != nil {
+		return EX_DATAERR
+	}
+
+	return EX_OK
+}
 
-		run([]byte(line))
+func printAst(source *token.Source) int {
+	statements, err := parse(source, newReporter())
+	if err != nil {
+		return EX_DATAERR
 	}
+
+	fmt.Print(printer.Print(statements))
+
+	return EX_OK
 }
 
-func runFile(path string) {
-	PERF = true
+func printBytecode(source *token.Source) int {
+	reporter := newReporter()
 
-	file, err := os.ReadFile(path)
+	statements, err := parse(source, reporter)
 	if err != nil {
-		log.Fatal(err)
+		return EX_DATAERR
 	}
-	code := run(file)
-	if code != EX_OK {
-		os.Exit(code)
+
+	if err := resolve(statements, reporter); err != nil {
+		return EX_DATAERR
+	}
+
+	function, err := compile(statements, reporter)
+	if err != nil {
+		return EX_DATAERR
 	}
+
+	fmt.Print(compiler.Disassemble(function))
+
+	return EX_OK
 }
 
 func printPerf(operation string, start int64) {
-	if !PERF {
+	if !*timing {
 		return
 	}
 
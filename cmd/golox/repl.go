@@ -0,0 +1,234 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fiurgeist/golox/internal/ast/expr"
+	"github.com/fiurgeist/golox/internal/ast/printer"
+	"github.com/fiurgeist/golox/internal/ast/stmt"
+	"github.com/fiurgeist/golox/internal/interpreter"
+	"github.com/fiurgeist/golox/internal/lexer"
+	"github.com/fiurgeist/golox/internal/lineeditor"
+	"github.com/fiurgeist/golox/internal/parser"
+	"github.com/fiurgeist/golox/internal/reporter"
+	"github.com/fiurgeist/golox/internal/token"
+)
+
+const replHelp = `Meta-commands:
+  :env         list the global variables
+  :load <file> run a script in the REPL environment
+  :reset       remove all global variables
+  :ast <code>  print the syntax tree of the code
+  :time        toggle printing the time each phase took
+  :help        show this help
+Expressions are printed, their trailing ';' can be omitted.`
+
+const historyFile = ".golox_history"
+
+type lineReader interface {
+	ReadLine(prompt string) (string, error)
+}
+
+// scannerReader reads lines from input that isn't a terminal, like a pipe.
+type scannerReader struct {
+	scanner *bufio.Scanner
+}
+
+func (r *scannerReader) ReadLine(prompt string) (string, error) {
+	fmt.Print(prompt)
+
+	if !r.scanner.Scan() {
+		if err := r.scanner.Err(); err != nil {
+			return "", err
+		}
+
+		fmt.Println("")
+		return "", io.EOF
+	}
+
+	return r.scanner.Text(), nil
+}
+
+func newLineReader() lineReader {
+	historyPath := ""
+	if home, err := os.UserHomeDir(); err == nil {
+		historyPath = filepath.Join(home, historyFile)
+	}
+
+	editor, err := lineeditor.NewEditor(os.Stdin, os.Stdout, historyPath, complete)
+	if err != nil {
+		return &scannerReader{scanner: bufio.NewScanner(os.Stdin)}
+	}
+
+	return editor
+}
+
+func runPrompt() {
+	reader := newLineReader()
+	fmt.Println("Lox REPL, :help for help")
+
+	var input []byte
+	for {
+		prompt := "> "
+		if len(input) != 0 {
+			prompt = "... "
+		}
+
+		line, err := reader.ReadLine(prompt)
+		if errors.Is(err, lineeditor.ErrInterrupted) {
+			input = nil // discard the incomplete input
+			continue
+		}
+		if errors.Is(err, io.EOF) {
+			if len(input) != 0 {
+				run(&token.Source{Code: input}, nil) // reports what is missing
+			}
+			return
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if len(input) == 0 && strings.HasPrefix(line, ":") {
+			metaCommand(line)
+			continue
+		}
+
+		input = append(input, line...)
+		input = append(input, '\n')
+
+		source := &token.Source{Code: input}
+		if expression := parseExpression(source); expression != nil {
+			printExpression(source, expression)
+			input = nil
+			continue
+		}
+
+		if isIncomplete(input) {
+			continue
+		}
+
+		run(source, nil)
+		input = nil
+	}
+}
+
+func metaCommand(line string) {
+	command, argument, _ := strings.Cut(line, " ")
+	argument = strings.TrimSpace(argument)
+
+	switch command {
+	case ":env":
+		for _, name := range environment.Names() {
+			value, _ := environment.Get(name)
+			fmt.Printf("%s = %s\n", name, interpreter.Stringify(value))
+		}
+	case ":load":
+		file, err := os.ReadFile(argument)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		run(&token.Source{Path: argument, Code: file}, nil)
+	case ":reset":
+		environment = interpreter.NewEnvironment()
+	case ":ast":
+		source := &token.Source{Code: []byte(argument)}
+		if expression := parseExpression(source); expression != nil {
+			fmt.Print(printer.Print([]stmt.Stmt{stmt.NewExpression(expression)}))
+			return
+		}
+		if statements, err := parse(source, newReporter()); err == nil {
+			fmt.Print(printer.Print(statements))
+		}
+	case ":time":
+		*timing = !*timing
+		fmt.Printf("Timing %s\n", map[bool]string{true: "on", false: "off"}[*timing])
+	case ":help":
+		fmt.Println(replHelp)
+	default:
+		fmt.Printf("Unknown meta-command '%s', see :help\n", command)
+	}
+}
+
+// parseExpression returns nil if the source isn't a single expression.
+func parseExpression(source *token.Source) expr.Expr {
+	reporter := &incompleteReporter{end: len(source.Code)} // only used to silence errors
+
+	lexer := lexer.NewLexer(source, reporter)
+	tokens, err := lexer.ScanTokens()
+	if err != nil {
+		return nil
+	}
+
+	parser := parser.NewParser(tokens, reporter)
+	expression, err := parser.ParseExpression()
+	if err != nil {
+		return nil
+	}
+
+	return expression
+}
+
+// printExpression evaluates the expression as if it was the argument of a print statement.
+func printExpression(source *token.Source, expression expr.Expr) {
+	statements := []stmt.Stmt{stmt.NewPrint(token.Token{}, expression)}
+	execute(source, statements, newReporter(), nil)
+}
+
+// isIncomplete tells if the only errors in the code are caused by it ending too early,
+// like unbalanced braces or an unterminated string or comment.
+func isIncomplete(code []byte) bool {
+	reporter := &incompleteReporter{end: len(code)}
+
+	lexer := lexer.NewLexer(&token.Source{Code: code}, reporter)
+	tokens, _ := lexer.ScanTokens()
+
+	parser := parser.NewParser(tokens, reporter)
+	parser.Parse()
+
+	return reporter.atEnd && !reporter.elsewhere
+}
+
+var _ reporter.ErrorReporter = (*incompleteReporter)(nil)
+
+// incompleteReporter only records where lexing and parse errors occur.
+type incompleteReporter struct {
+	end       int  // of the code
+	atEnd     bool // any error at the end of the code
+	elsewhere bool // any other error
+}
+
+func (r *incompleteReporter) LexingError(span token.Span, message string) {
+	if span.Offset+span.Length >= r.end {
+		r.atEnd = true
+	} else {
+		r.elsewhere = true
+	}
+}
+
+func (r *incompleteReporter) ParseError(parsedToken token.Token, message string) {
+	if parsedToken.Type == token.EOF {
+		r.atEnd = true
+	} else {
+		r.elsewhere = true
+	}
+}
+
+func (r *incompleteReporter) ResolveError(resolvedToken token.Token, message string) {}
+
+func (r *incompleteReporter) Warning(resolvedToken token.Token, message string) {}
+
+func (r *incompleteReporter) RuntimeError(token token.Token, message string, trace []reporter.StackFrame) {
+}
+
+func (r *incompleteReporter) Report(span token.Span, where, message string) {
+	r.elsewhere = true
+}
@@ -2,15 +2,25 @@ package expr
 
 import (
 	"fmt"
+	"strings"
 
 	"github.com/fiurgeist/golox/internal/token"
 )
 
 type Expr interface {
 	isExpr()
+	Span() token.Span
 	String() string
 }
 
+// Resolution tells where the variable an expression refers to is stored, it's set by the resolver.
+// Locals are found Depth environments up from the current one at Slot, globals by name.
+type Resolution struct {
+	Local bool
+	Depth int
+	Slot  int
+}
+
 type Binary struct {
 	Left     Expr
 	Operator token.Token
@@ -22,6 +32,9 @@ func NewBinary(left Expr, operator token.Token, right Expr) *Binary {
 }
 
 func (e *Binary) isExpr() {}
+func (e *Binary) Span() token.Span {
+	return e.Left.Span().To(e.Right.Span())
+}
 func (e *Binary) String() string {
 	return fmt.Sprintf("%s %s %s", e.Left, e.Operator.Lexeme, e.Right)
 }
@@ -37,6 +50,9 @@ func NewLogical(left Expr, operator token.Token, right Expr) *Logical {
 }
 
 func (e *Logical) isExpr() {}
+func (e *Logical) Span() token.Span {
+	return e.Left.Span().To(e.Right.Span())
+}
 func (e *Logical) String() string {
 	return fmt.Sprintf("%s %s %s", e.Left, e.Operator.Lexeme, e.Right)
 }
@@ -50,6 +66,9 @@ func NewGrouping(expression Expr) *Grouping {
 }
 
 func (e *Grouping) isExpr() {}
+func (e *Grouping) Span() token.Span {
+	return e.Expression.Span()
+}
 func (e *Grouping) String() string {
 	return fmt.Sprintf("(%s)", e.Expression)
 }
@@ -64,19 +83,26 @@ func NewUnary(operator token.Token, right Expr) *Unary {
 }
 
 func (e *Unary) isExpr() {}
+func (e *Unary) Span() token.Span {
+	return e.Operator.Span.To(e.Right.Span())
+}
 func (e *Unary) String() string {
 	return fmt.Sprintf("%s%s", e.Operator.Lexeme, e.Right)
 }
 
 type Literal struct {
 	Value interface{}
+	Token token.Token
 }
 
-func NewLiteral(value interface{}) *Literal {
-	return &Literal{Value: value}
+func NewLiteral(value interface{}, token token.Token) *Literal {
+	return &Literal{Value: value, Token: token}
 }
 
 func (e *Literal) isExpr() {}
+func (e *Literal) Span() token.Span {
+	return e.Token.Span
+}
 func (e *Literal) String() string {
 	if e.Value == nil {
 		return "nil"
@@ -86,7 +112,8 @@ func (e *Literal) String() string {
 }
 
 type Variable struct {
-	Name token.Token
+	Name       token.Token
+	Resolution Resolution
 }
 
 func NewVariable(name token.Token) *Variable {
@@ -94,13 +121,17 @@ func NewVariable(name token.Token) *Variable {
 }
 
 func (e *Variable) isExpr() {}
+func (e *Variable) Span() token.Span {
+	return e.Name.Span
+}
 func (e *Variable) String() string {
 	return e.Name.Lexeme
 }
 
 type Assign struct {
-	Name  token.Token
-	Value Expr
+	Name       token.Token
+	Value      Expr
+	Resolution Resolution
 }
 
 func NewAssign(name token.Token, value Expr) *Assign {
@@ -108,6 +139,9 @@ func NewAssign(name token.Token, value Expr) *Assign {
 }
 
 func (e *Assign) isExpr() {}
+func (e *Assign) Span() token.Span {
+	return e.Name.Span.To(e.Value.Span())
+}
 func (e *Assign) String() string {
 	return fmt.Sprintf("%s = %s", e.Name.Lexeme, e.Value)
 }
@@ -123,6 +157,9 @@ func NewCall(callee Expr, arguments []Expr, closingParen token.Token) *Call {
 }
 
 func (e *Call) isExpr() {}
+func (e *Call) Span() token.Span {
+	return e.Callee.Span().To(e.ClosingParen.Span)
+}
 func (e *Call) String() string {
 	return e.Callee.String()
 }
@@ -137,6 +174,9 @@ func NewGet(object Expr, name token.Token) *Get {
 }
 
 func (e *Get) isExpr() {}
+func (e *Get) Span() token.Span {
+	return e.Object.Span().To(e.Name.Span)
+}
 func (e *Get) String() string {
 	return e.Name.Lexeme
 }
@@ -152,12 +192,16 @@ func NewSet(object Expr, name token.Token, value Expr) *Set {
 }
 
 func (e *Set) isExpr() {}
+func (e *Set) Span() token.Span {
+	return e.Object.Span().To(e.Value.Span())
+}
 func (e *Set) String() string {
 	return e.Name.Lexeme
 }
 
 type This struct {
-	Keyword token.Token
+	Keyword    token.Token
+	Resolution Resolution
 }
 
 func NewThis(keyword token.Token) *This {
@@ -165,13 +209,17 @@ func NewThis(keyword token.Token) *This {
 }
 
 func (e *This) isExpr() {}
+func (e *This) Span() token.Span {
+	return e.Keyword.Span
+}
 func (e *This) String() string {
 	return e.Keyword.Lexeme
 }
 
 type Super struct {
-	Keyword token.Token
-	Method  token.Token
+	Keyword    token.Token
+	Method     token.Token
+	Resolution Resolution
 }
 
 func NewSuper(keyword token.Token, method token.Token) *Super {
@@ -179,6 +227,137 @@ func NewSuper(keyword token.Token, method token.Token) *Super {
 }
 
 func (e *Super) isExpr() {}
+func (e *Super) Span() token.Span {
+	return e.Keyword.Span.To(e.Method.Span)
+}
 func (e *Super) String() string {
 	return e.Keyword.Lexeme
 }
+
+type List struct {
+	Bracket        token.Token
+	Elements       []Expr
+	ClosingBracket token.Token
+}
+
+func NewList(bracket token.Token, elements []Expr, closingBracket token.Token) *List {
+	return &List{Bracket: bracket, Elements: elements, ClosingBracket: closingBracket}
+}
+
+func (e *List) isExpr() {}
+func (e *List) Span() token.Span {
+	return e.Bracket.Span.To(e.ClosingBracket.Span)
+}
+func (e *List) String() string {
+	elements := make([]string, len(e.Elements))
+	for i, element := range e.Elements {
+		elements[i] = element.String()
+	}
+
+	return fmt.Sprintf("[%s]", strings.Join(elements, ", "))
+}
+
+type Index struct {
+	Object  Expr
+	Bracket token.Token
+	Index   Expr
+}
+
+func NewIndex(object Expr, bracket token.Token, index Expr) *Index {
+	return &Index{Object: object, Bracket: bracket, Index: index}
+}
+
+func (e *Index) isExpr() {}
+func (e *Index) Span() token.Span {
+	return e.Object.Span().To(e.Bracket.Span)
+}
+func (e *Index) String() string {
+	return fmt.Sprintf("%s[%s]", e.Object, e.Index)
+}
+
+type IndexSet struct {
+	Object  Expr
+	Bracket token.Token
+	Index   Expr
+	Value   Expr
+}
+
+func NewIndexSet(object Expr, bracket token.Token, index Expr, value Expr) *IndexSet {
+	return &IndexSet{Object: object, Bracket: bracket, Index: index, Value: value}
+}
+
+func (e *IndexSet) isExpr() {}
+func (e *IndexSet) Span() token.Span {
+	return e.Object.Span().To(e.Value.Span())
+}
+func (e *IndexSet) String() string {
+	return fmt.Sprintf("%s[%s] = %s", e.Object, e.Index, e.Value)
+}
+
+type Map struct {
+	Brace        token.Token
+	Keys         []Expr
+	Values       []Expr
+	ClosingBrace token.Token
+}
+
+func NewMap(brace token.Token, keys []Expr, values []Expr, closingBrace token.Token) *Map {
+	return &Map{Brace: brace, Keys: keys, Values: values, ClosingBrace: closingBrace}
+}
+
+func (e *Map) isExpr() {}
+func (e *Map) Span() token.Span {
+	return e.Brace.Span.To(e.ClosingBrace.Span)
+}
+func (e *Map) String() string {
+	entries := make([]string, len(e.Keys))
+	for i, key := range e.Keys {
+		entries[i] = fmt.Sprintf("%s: %s", key, e.Values[i])
+	}
+
+	return fmt.Sprintf("{%s}", strings.Join(entries, ", "))
+}
+
+type Interpolation struct {
+	Parts []Expr
+}
+
+func NewInterpolation(parts []Expr) *Interpolation {
+	return &Interpolation{Parts: parts}
+}
+
+func (e *Interpolation) isExpr() {}
+func (e *Interpolation) Span() token.Span {
+	return e.Parts[0].Span().To(e.Parts[len(e.Parts)-1].Span())
+}
+func (e *Interpolation) String() string {
+	var b strings.Builder
+	for _, part := range e.Parts {
+		if literal, ok := part.(*Literal); ok {
+			if s, ok := literal.Value.(string); ok {
+				b.WriteString(s)
+				continue
+			}
+		}
+		fmt.Fprintf(&b, "${%s}", part)
+	}
+
+	return fmt.Sprintf("\"%s\"", b.String())
+}
+
+type Function struct {
+	Keyword     token.Token // "fun" or "=>"
+	Declaration interface{} // *stmt.Function, which can't be referenced as stmt depends on expr
+}
+
+func NewFunction(keyword token.Token, declaration interface{}) *Function {
+	return &Function{Keyword: keyword, Declaration: declaration}
+}
+
+func (e *Function) isExpr() {}
+func (e *Function) Span() token.Span {
+	return e.Keyword.Span
+}
+func (e *Function) String() string {
+	return "<fn anonymous>"
+}
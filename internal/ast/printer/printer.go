@@ -0,0 +1,199 @@
+package printer
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/fiurgeist/golox/internal/ast/expr"
+	"github.com/fiurgeist/golox/internal/ast/stmt"
+)
+
+// Print renders the syntax tree as parenthesized prefix notation, one top-level statement per line.
+func Print(statements []stmt.Stmt) string {
+	p := printer{}
+
+	var b strings.Builder
+	for _, statement := range statements {
+		b.WriteString(p.stmt(statement))
+		b.WriteByte('\n')
+	}
+
+	return b.String()
+}
+
+type printer struct {
+	depth int // of nested statement lists
+}
+
+func (p *printer) stmt(statement stmt.Stmt) string {
+	switch s := statement.(type) {
+	case *stmt.Expression:
+		return p.parenthesize("expr", s.Expression)
+	case *stmt.Print:
+		return p.parenthesize("print", s.Expression)
+	case *stmt.Var:
+		if s.Initializer == nil {
+			return fmt.Sprintf("(var %s)", s.Name.Lexeme)
+		}
+		return p.parenthesize("var "+s.Name.Lexeme, s.Initializer)
+	case *stmt.Block:
+		return p.block("block", s.Statements)
+	case *stmt.If:
+		if s.ElseBranch == nil {
+			return p.parenthesize("if", s.Condition, s.ThenBranch)
+		}
+		return p.parenthesize("if", s.Condition, s.ThenBranch, s.ElseBranch)
+	case *stmt.While:
+		if s.Increment == nil {
+			return p.parenthesize(s.Keyword.Lexeme, s.Condition, s.Body)
+		}
+		return p.parenthesize(s.Keyword.Lexeme, s.Condition, s.Increment, s.Body)
+	case *stmt.Break:
+		return "(break)"
+	case *stmt.Continue:
+		return "(continue)"
+	case *stmt.Import:
+		return fmt.Sprintf("(import %s as %s)", s.Path.Lexeme, s.Name.Lexeme)
+	case *stmt.Throw:
+		return p.parenthesize("throw", s.Value)
+	case *stmt.Try:
+		parts := []interface{}{p.block("block", s.Body)}
+		if s.CatchName != nil {
+			parts = append(parts, p.block("catch "+s.CatchName.Lexeme, s.CatchBody))
+		}
+		if s.FinallyBody != nil {
+			parts = append(parts, p.block("finally", s.FinallyBody))
+		}
+		return p.parenthesize("try", parts...)
+	case *stmt.Function:
+		return p.function("fun "+s.Name.Lexeme, s)
+	case *stmt.Return:
+		if s.Value == nil {
+			return "(return)"
+		}
+		return p.parenthesize("return", s.Value)
+	case *stmt.Class:
+		name := "class " + s.Name.Lexeme
+		if s.Superclass != nil {
+			name += " < " + s.Superclass.Name.Lexeme
+		}
+
+		methods := make([]stmt.Stmt, len(s.Methods))
+		for i, method := range s.Methods {
+			methods[i] = method
+		}
+		return p.block(name, methods)
+	}
+
+	panic(fmt.Sprintf("Unhandled statement type %T", statement))
+}
+
+func (p *printer) expr(expression expr.Expr) string {
+	switch e := expression.(type) {
+	case *expr.Literal:
+		switch value := e.Value.(type) {
+		case nil:
+			return "nil"
+		case string:
+			return strconv.Quote(value)
+		case float64:
+			return strconv.FormatFloat(value, 'f', -1, 64)
+		}
+		return fmt.Sprintf("%v", e.Value)
+	case *expr.Grouping:
+		return p.parenthesize("group", e.Expression)
+	case *expr.Unary:
+		return p.parenthesize(e.Operator.Lexeme, e.Right)
+	case *expr.Binary:
+		return p.parenthesize(e.Operator.Lexeme, e.Left, e.Right)
+	case *expr.Logical:
+		return p.parenthesize(e.Operator.Lexeme, e.Left, e.Right)
+	case *expr.Variable:
+		return e.Name.Lexeme
+	case *expr.Assign:
+		return p.parenthesize("= "+e.Name.Lexeme, e.Value)
+	case *expr.Call:
+		return p.parenthesize("call", append([]interface{}{e.Callee}, exprs(e.Arguments)...)...)
+	case *expr.Get:
+		return p.parenthesize("get "+e.Name.Lexeme, e.Object)
+	case *expr.Set:
+		return p.parenthesize("set "+e.Name.Lexeme, e.Object, e.Value)
+	case *expr.This:
+		return "this"
+	case *expr.Super:
+		return fmt.Sprintf("(super %s)", e.Method.Lexeme)
+	case *expr.List:
+		return p.parenthesize("list", exprs(e.Elements)...)
+	case *expr.Index:
+		return p.parenthesize("index", e.Object, e.Index)
+	case *expr.IndexSet:
+		return p.parenthesize("index=", e.Object, e.Index, e.Value)
+	case *expr.Map:
+		entries := make([]interface{}, len(e.Keys))
+		for i, key := range e.Keys {
+			entries[i] = p.parenthesize(":", key, e.Values[i])
+		}
+		return p.parenthesize("map", entries...)
+	case *expr.Interpolation:
+		return p.parenthesize("interpolate", exprs(e.Parts)...)
+	case *expr.Function:
+		return p.function("fun", e.Declaration.(*stmt.Function))
+	}
+
+	panic(fmt.Sprintf("Unhandled expression type %T", expression))
+}
+
+func (p *printer) function(name string, function *stmt.Function) string {
+	params := make([]string, len(function.Params))
+	for i, param := range function.Params {
+		params[i] = param.Lexeme
+	}
+
+	return p.block(fmt.Sprintf("%s (%s)", name, strings.Join(params, " ")), function.Body)
+}
+
+// block puts each statement on its own, indented line.
+func (p *printer) block(name string, statements []stmt.Stmt) string {
+	p.depth++
+	defer func() { p.depth-- }()
+
+	var b strings.Builder
+	b.WriteString("(" + name)
+	for _, statement := range statements {
+		b.WriteString("\n" + strings.Repeat("  ", p.depth))
+		b.WriteString(p.stmt(statement))
+	}
+	b.WriteString(")")
+
+	return b.String()
+}
+
+// parenthesize accepts expressions, statements and already printed strings as parts.
+func (p *printer) parenthesize(name string, parts ...interface{}) string {
+	var b strings.Builder
+	b.WriteString("(" + name)
+	for _, part := range parts {
+		b.WriteString(" ")
+		switch part := part.(type) {
+		case expr.Expr:
+			b.WriteString(p.expr(part))
+		case stmt.Stmt:
+			b.WriteString(p.stmt(part))
+		case string:
+			b.WriteString(part)
+		}
+	}
+	b.WriteString(")")
+
+	return b.String()
+}
+
+func exprs(expressions []expr.Expr) []interface{} {
+	parts := make([]interface{}, len(expressions))
+	for i, expression := range expressions {
+		parts[i] = expression
+	}
+
+	return parts
+}
@@ -7,6 +7,16 @@ import (
 
 type Stmt interface {
 	isStmt()
+	Span() token.Span
+}
+
+// spanOf covers all statements, it's empty without any.
+func spanOf(statements []Stmt) token.Span {
+	if len(statements) == 0 {
+		return token.Span{}
+	}
+
+	return statements[0].Span().To(statements[len(statements)-1].Span())
 }
 
 type Expression struct {
@@ -18,16 +28,23 @@ func NewExpression(expression expr.Expr) *Expression {
 }
 
 func (s *Expression) isStmt() {}
+func (s *Expression) Span() token.Span {
+	return s.Expression.Span()
+}
 
 type Print struct {
+	Keyword    token.Token
 	Expression expr.Expr
 }
 
-func NewPrint(expression expr.Expr) *Print {
-	return &Print{Expression: expression}
+func NewPrint(keyword token.Token, expression expr.Expr) *Print {
+	return &Print{Keyword: keyword, Expression: expression}
 }
 
 func (s *Print) isStmt() {}
+func (s *Print) Span() token.Span {
+	return s.Keyword.Span.To(s.Expression.Span())
+}
 
 type Var struct {
 	Name        token.Token
@@ -39,6 +56,13 @@ func NewVar(name token.Token, initializer expr.Expr) *Var {
 }
 
 func (s *Var) isStmt() {}
+func (s *Var) Span() token.Span {
+	if s.Initializer == nil {
+		return s.Name.Span
+	}
+
+	return s.Name.Span.To(s.Initializer.Span())
+}
 
 type Block struct {
 	Statements []Stmt
@@ -49,37 +73,129 @@ func NewBlock(statements []Stmt) *Block {
 }
 
 func (s *Block) isStmt() {}
+func (s *Block) Span() token.Span {
+	return spanOf(s.Statements)
+}
 
 type If struct {
+	Keyword    token.Token
 	Condition  expr.Expr
 	ThenBranch Stmt
 	ElseBranch Stmt
 }
 
-func NewIf(condition expr.Expr, thenBranch, elseBranch Stmt) *If {
-	return &If{Condition: condition, ThenBranch: thenBranch, ElseBranch: elseBranch}
+func NewIf(keyword token.Token, condition expr.Expr, thenBranch, elseBranch Stmt) *If {
+	return &If{Keyword: keyword, Condition: condition, ThenBranch: thenBranch, ElseBranch: elseBranch}
 }
 
 func (s *If) isStmt() {}
+func (s *If) Span() token.Span {
+	if s.ElseBranch == nil {
+		return s.Keyword.Span.To(s.ThenBranch.Span())
+	}
+
+	return s.Keyword.Span.To(s.ElseBranch.Span())
+}
 
 type While struct {
+	Keyword   token.Token // "while" or "for"
 	Condition expr.Expr
 	Body      Stmt
+	Increment expr.Expr // of a desugared for loop, nil otherwise
 }
 
-func NewWhile(condition expr.Expr, body Stmt) *While {
-	return &While{Condition: condition, Body: body}
+func NewWhile(keyword token.Token, condition expr.Expr, body Stmt, increment expr.Expr) *While {
+	return &While{Keyword: keyword, Condition: condition, Body: body, Increment: increment}
 }
 
 func (s *While) isStmt() {}
+func (s *While) Span() token.Span {
+	return s.Keyword.Span.To(s.Body.Span())
+}
 
-type Break struct{}
+type Break struct {
+	Keyword token.Token
+}
 
-func NewBreak() *Break {
-	return &Break{}
+func NewBreak(keyword token.Token) *Break {
+	return &Break{Keyword: keyword}
 }
 
 func (s *Break) isStmt() {}
+func (s *Break) Span() token.Span {
+	return s.Keyword.Span
+}
+
+type Continue struct {
+	Keyword token.Token
+}
+
+func NewContinue(keyword token.Token) *Continue {
+	return &Continue{Keyword: keyword}
+}
+
+func (s *Continue) isStmt() {}
+func (s *Continue) Span() token.Span {
+	return s.Keyword.Span
+}
+
+type Import struct {
+	Keyword token.Token
+	Path    token.Token
+	Name    token.Token
+}
+
+func NewImport(keyword token.Token, path token.Token, name token.Token) *Import {
+	return &Import{Keyword: keyword, Path: path, Name: name}
+}
+
+func (s *Import) isStmt() {}
+func (s *Import) Span() token.Span {
+	return s.Keyword.Span.To(s.Name.Span)
+}
+
+type Throw struct {
+	Keyword token.Token
+	Value   expr.Expr
+}
+
+func NewThrow(keyword token.Token, value expr.Expr) *Throw {
+	return &Throw{Keyword: keyword, Value: value}
+}
+
+func (s *Throw) isStmt() {}
+func (s *Throw) Span() token.Span {
+	return s.Keyword.Span.To(s.Value.Span())
+}
+
+type Try struct {
+	Keyword     token.Token
+	Body        []Stmt
+	CatchName   *token.Token // nil without a catch clause
+	CatchBody   []Stmt
+	FinallyBody []Stmt
+}
+
+func NewTry(
+	keyword token.Token,
+	body []Stmt,
+	catchName *token.Token,
+	catchBody []Stmt,
+	finallyBody []Stmt,
+) *Try {
+	return &Try{
+		Keyword:     keyword,
+		Body:        body,
+		CatchName:   catchName,
+		CatchBody:   catchBody,
+		FinallyBody: finallyBody,
+	}
+}
+
+func (s *Try) isStmt() {}
+func (s *Try) Span() token.Span {
+	return s.Keyword.Span.To(spanOf(s.Body)).To(spanOf(s.CatchBody)).To(spanOf(s.FinallyBody))
+}
 
 type Function struct {
 	Name   token.Token
@@ -92,6 +208,9 @@ func NewFunction(name token.Token, params []token.Token, body []Stmt) *Function
 }
 
 func (s *Function) isStmt() {}
+func (s *Function) Span() token.Span {
+	return s.Name.Span.To(spanOf(s.Body))
+}
 
 type Return struct {
 	Keyword token.Token
@@ -103,6 +222,13 @@ func NewReturn(keyword token.Token, value expr.Expr) *Return {
 }
 
 func (s *Return) isStmt() {}
+func (s *Return) Span() token.Span {
+	if s.Value == nil {
+		return s.Keyword.Span
+	}
+
+	return s.Keyword.Span.To(s.Value.Span())
+}
 
 type Class struct {
 	Name       token.Token
@@ -115,3 +241,6 @@ func NewClass(name token.Token, superclass *expr.Variable, methods []*Function)
 }
 
 func (s *Class) isStmt() {}
+func (s *Class) Span() token.Span {
+	return s.Name.Span
+}
@@ -0,0 +1,189 @@
+package compiler
+
+import (
+	"sort"
+
+	"github.com/fiurgeist/golox/internal/token"
+)
+
+type OpCode byte
+
+// Operands follow their instruction in big-endian order: slots, upvalue indices and argument
+// counts take one byte, slots and upvalue indices of the _LONG variants two bytes. Constant
+// indices, jump offsets and counts take three bytes, as jumps are emitted before their offset is
+// known and a single width keeps them simple.
+const (
+	OpConstant       OpCode = iota // constant: push the constant
+	OpNil                          // push nil
+	OpTrue                         // push true
+	OpFalse                        // push false
+	OpPop                          // pop the top value
+	OpGetLocal                     // slot: push the local
+	OpSetLocal                     // slot: store the top value in the local
+	OpGetGlobal                    // name constant: push the global
+	OpDefineGlobal                 // name constant: pop the top value into a new global
+	OpSetGlobal                    // name constant: store the top value in an existing global
+	OpGetUpvalue                   // index: push the upvalue
+	OpSetUpvalue                   // index: store the top value in the upvalue
+	OpGetLocalLong                 // like OpGetLocal for slots beyond 255
+	OpSetLocalLong                 //
+	OpGetUpvalueLong               // like OpGetUpvalue for indices beyond 255
+	OpSetUpvalueLong               //
+	OpGetProperty                  // name constant: replace the object with its property
+	OpSetProperty                  // name constant: set the property of the object below the value
+	OpGetSuper                     // name constant: replace 'this' and the superclass with the bound method
+	OpGetIndex                     // replace the object and the index with the element
+	OpSetIndex                     // set the element of the object and index below the value
+	OpEqual                        // replace two values with the result of the comparison
+	OpNotEqual                     //
+	OpGreater                      //
+	OpGreaterEqual                 //
+	OpLess                         //
+	OpLessEqual                    //
+	OpAdd                          // replace two values with the result of the operation
+	OpSubtract                     //
+	OpMultiply                     //
+	OpDivide                       //
+	OpNot                          // replace the top value with the result of the operation
+	OpNegate                       //
+	OpPrint                        // pop and print the top value
+	OpJump                         // offset: jump forward
+	OpJumpIfFalse                  // offset: jump forward if the top value is falsey, without popping it
+	OpLoop                         // offset: jump backward
+	OpCall                         // argument count: call the value below the arguments
+	OpInvoke                       // name constant, argument count: call the method of the object below the arguments
+	OpSuperInvoke                  // name constant, argument count: call the method of the superclass on top of the arguments
+	OpClosure                      // function constant, per upvalue is local (one byte) and index (two bytes): push a closure
+	OpCloseUpvalue                 // move the top value into its upvalue and pop it
+	OpReturn                       // return the top value from the function
+	OpSetReturn                    // pop the top value as return value of a return running finally blocks
+	OpReturnPending                // return the value stored by OpSetReturn
+	OpClass                        // name constant: push a new class
+	OpInherit                      // copy the methods of the superclass below the class, pop the class
+	OpMethod                       // name constant: add the closure on top to the class below, pop it
+	OpList                         // count: replace the elements with a list
+	OpMap                          // count: replace the keys and values with a map
+	OpInterpolate                  // count: replace the values with the concatenation of their strings
+	OpThrow                        // pop and throw the top value
+	OpTry                          // offset: push an exception handler jumping forward
+	OpEndTry                       // pop the exception handler
+	OpCatch                        // replace the caught exception with its value
+	OpRethrow                      // pop the caught exception and throw it again
+	OpImport                       // path constant: push the imported module
+)
+
+var opNames = [...]string{
+	OpConstant:       "CONSTANT",
+	OpNil:            "NIL",
+	OpTrue:           "TRUE",
+	OpFalse:          "FALSE",
+	OpPop:            "POP",
+	OpGetLocal:       "GET_LOCAL",
+	OpSetLocal:       "SET_LOCAL",
+	OpGetGlobal:      "GET_GLOBAL",
+	OpDefineGlobal:   "DEFINE_GLOBAL",
+	OpSetGlobal:      "SET_GLOBAL",
+	OpGetUpvalue:     "GET_UPVALUE",
+	OpSetUpvalue:     "SET_UPVALUE",
+	OpGetLocalLong:   "GET_LOCAL_LONG",
+	OpSetLocalLong:   "SET_LOCAL_LONG",
+	OpGetUpvalueLong: "GET_UPVALUE_LONG",
+	OpSetUpvalueLong: "SET_UPVALUE_LONG",
+	OpGetProperty:    "GET_PROPERTY",
+	OpSetProperty:    "SET_PROPERTY",
+	OpGetSuper:       "GET_SUPER",
+	OpGetIndex:       "GET_INDEX",
+	OpSetIndex:       "SET_INDEX",
+	OpEqual:          "EQUAL",
+	OpNotEqual:       "NOT_EQUAL",
+	OpGreater:        "GREATER",
+	OpGreaterEqual:   "GREATER_EQUAL",
+	OpLess:           "LESS",
+	OpLessEqual:      "LESS_EQUAL",
+	OpAdd:            "ADD",
+	OpSubtract:       "SUBTRACT",
+	OpMultiply:       "MULTIPLY",
+	OpDivide:         "DIVIDE",
+	OpNot:            "NOT",
+	OpNegate:         "NEGATE",
+	OpPrint:          "PRINT",
+	OpJump:           "JUMP",
+	OpJumpIfFalse:    "JUMP_IF_FALSE",
+	OpLoop:           "LOOP",
+	OpCall:           "CALL",
+	OpInvoke:         "INVOKE",
+	OpSuperInvoke:    "SUPER_INVOKE",
+	OpClosure:        "CLOSURE",
+	OpCloseUpvalue:   "CLOSE_UPVALUE",
+	OpReturn:         "RETURN",
+	OpSetReturn:      "SET_RETURN",
+	OpReturnPending:  "RETURN_PENDING",
+	OpClass:          "CLASS",
+	OpInherit:        "INHERIT",
+	OpMethod:         "METHOD",
+	OpList:           "LIST",
+	OpMap:            "MAP",
+	OpInterpolate:    "INTERPOLATE",
+	OpThrow:          "THROW",
+	OpTry:            "TRY",
+	OpEndTry:         "END_TRY",
+	OpCatch:          "CATCH",
+	OpRethrow:        "RETHROW",
+	OpImport:         "IMPORT",
+}
+
+func (op OpCode) String() string {
+	if int(op) < len(opNames) {
+		return opNames[op]
+	}
+
+	return "UNKNOWN"
+}
+
+// Chunk is the bytecode of a function with its constants. The source spans of the instructions
+// are kept separately for error messages.
+type Chunk struct {
+	Code      []byte
+	Constants []interface{} // float64, string or *Function
+	spans     []spanStart
+	sources   map[int]string // source code of callees and objects of the instruction at an offset
+}
+
+// spanStart is the span of the instructions from offset up to the next spanStart.
+type spanStart struct {
+	offset int
+	span   token.Span
+}
+
+func (c *Chunk) write(b byte, span token.Span) {
+	if len(c.spans) == 0 || c.spans[len(c.spans)-1].span != span {
+		c.spans = append(c.spans, spanStart{offset: len(c.Code), span: span})
+	}
+
+	c.Code = append(c.Code, b)
+}
+
+// Span returns the source span of the instruction at offset.
+func (c *Chunk) Span(offset int) token.Span {
+	i := sort.Search(len(c.spans), func(i int) bool { return c.spans[i].offset > offset })
+	if i == 0 {
+		return token.Span{}
+	}
+
+	return c.spans[i-1].span
+}
+
+// Source returns the source code of the callee or object the instruction at offset operates on.
+func (c *Chunk) Source(offset int) string {
+	return c.sources[offset]
+}
+
+// ReadShort reads the two byte operand at offset.
+func (c *Chunk) ReadShort(offset int) int {
+	return int(c.Code[offset])<<8 | int(c.Code[offset+1])
+}
+
+// ReadLong reads the three byte operand at offset.
+func (c *Chunk) ReadLong(offset int) int {
+	return int(c.Code[offset])<<16 | int(c.Code[offset+1])<<8 | int(c.Code[offset+2])
+}
@@ -0,0 +1,834 @@
+package compiler
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/fiurgeist/golox/internal/ast/expr"
+	"github.com/fiurgeist/golox/internal/ast/function"
+	"github.com/fiurgeist/golox/internal/ast/stmt"
+	"github.com/fiurgeist/golox/internal/reporter"
+	"github.com/fiurgeist/golox/internal/token"
+)
+
+var ErrCompiler = errors.New("CompileError")
+
+const (
+	maxLocals    = 1 << 16
+	maxUpvalues  = 1 << 16
+	maxConstants = 1 << 24
+	maxLong      = 1<<24 - 1 // of three byte operands
+)
+
+// longOps are the variants of the instructions taking a slot or an upvalue index beyond 255.
+var longOps = map[OpCode]OpCode{
+	OpGetLocal:   OpGetLocalLong,
+	OpSetLocal:   OpSetLocalLong,
+	OpGetUpvalue: OpGetUpvalueLong,
+	OpSetUpvalue: OpSetUpvalueLong,
+}
+
+// Compiler lowers resolved statements to bytecode. Whether a variable is local is taken from the
+// resolution, the compiler assigns the stack slots and upvalues itself.
+type Compiler struct {
+	reporter reporter.ErrorReporter
+	hasError bool
+	current  *functionState
+}
+
+// functionState is the state of the function being compiled, nested functions get their own.
+type functionState struct {
+	enclosing  *functionState
+	function   *Function
+	kind       function.Type
+	locals     []local
+	upvalues   []upvalue
+	constants  map[interface{}]int // indices of the constants but functions, to reuse them
+	scopeDepth int
+	loops      []*loop
+	tries      []*try
+}
+
+type local struct {
+	name     string // empty for values without a name, like slot zero of functions
+	depth    int
+	captured bool
+}
+
+type upvalue struct {
+	index   int
+	isLocal bool // a local of the enclosing function, an upvalue of it otherwise
+}
+
+// loop collects the jumps of break and continue statements, which are patched once the targets
+// are known.
+type loop struct {
+	localCount int // when entering the loop
+	tryCount   int // when entering the loop
+	breaks     []int
+	continues  []int
+}
+
+// try is a try statement being compiled. Leaving it with break, continue or return pops its
+// exception handler and runs a copy of its finally block.
+type try struct {
+	localCount int // when entering the try statement
+	handler    bool
+	finally    []stmt.Stmt
+}
+
+func NewCompiler(reporter reporter.ErrorReporter) Compiler {
+	return Compiler{reporter: reporter}
+}
+
+// Compile returns the function running the statements as script.
+func (c *Compiler) Compile(statements []stmt.Stmt) (*Function, error) {
+	c.current = &functionState{
+		function: &Function{},
+		kind:     function.NONE,
+		locals:   []local{{}}, // the script closure itself
+	}
+
+	c.statements(statements)
+	c.emitReturn(token.Span{})
+
+	if c.hasError {
+		return nil, ErrCompiler
+	}
+
+	return c.current.function, nil
+}
+
+func (c *Compiler) statements(statements []stmt.Stmt) {
+	for _, statement := range statements {
+		c.statement(statement)
+	}
+}
+
+func (c *Compiler) statement(statement stmt.Stmt) {
+	switch s := statement.(type) {
+	case *stmt.Print:
+		c.expression(s.Expression)
+		c.emit(s.Span(), OpPrint)
+	case *stmt.Var:
+		if s.Initializer != nil {
+			c.expression(s.Initializer)
+		} else {
+			c.emit(s.Name.Span, OpNil)
+		}
+		// declared after the initializer, which may refer to a shadowed variable of the same name
+		c.declareVariable(s.Name)
+		c.defineVariable(s.Name)
+	case *stmt.Expression:
+		c.expression(s.Expression)
+		c.emit(s.Span(), OpPop)
+	case *stmt.Block:
+		c.beginScope()
+		c.statements(s.Statements)
+		c.endScope(s.Span())
+	case *stmt.If:
+		c.ifStatement(s)
+	case *stmt.While:
+		c.whileStatement(s)
+	case *stmt.Break:
+		c.breakStatement(s)
+	case *stmt.Continue:
+		c.continueStatement(s)
+	case *stmt.Function:
+		c.declareVariable(s.Name)
+		c.function(s, function.FUNCTION, "")
+		c.defineVariable(s.Name)
+	case *stmt.Return:
+		c.returnStatement(s)
+	case *stmt.Import:
+		c.emitConstantOp(s.Path.Span, OpImport, s.Path.Literal.(string))
+		c.declareVariable(s.Name)
+		c.defineVariable(s.Name)
+	case *stmt.Throw:
+		c.expression(s.Value)
+		c.emit(s.Keyword.Span, OpThrow)
+	case *stmt.Try:
+		c.tryStatement(s)
+	case *stmt.Class:
+		c.classStatement(s)
+	default:
+		panic(fmt.Sprintf("Unhandled statement %#v", statement))
+	}
+}
+
+func (c *Compiler) ifStatement(s *stmt.If) {
+	c.expression(s.Condition)
+	thenJump := c.emitJump(s.Keyword.Span, OpJumpIfFalse)
+	c.emit(s.Keyword.Span, OpPop)
+	c.statement(s.ThenBranch)
+
+	elseJump := c.emitJump(s.Keyword.Span, OpJump)
+	c.patchJump(thenJump)
+	c.emit(s.Keyword.Span, OpPop)
+	if s.ElseBranch != nil {
+		c.statement(s.ElseBranch)
+	}
+	c.patchJump(elseJump)
+}
+
+// whileStatement runs the increment of a desugared for loop after the body, which continue
+// jumps to.
+func (c *Compiler) whileStatement(s *stmt.While) {
+	span := s.Keyword.Span
+	l := &loop{localCount: len(c.current.locals), tryCount: len(c.current.tries)}
+	c.current.loops = append(c.current.loops, l)
+
+	start := len(c.chunk().Code)
+	c.expression(s.Condition)
+	exitJump := c.emitJump(span, OpJumpIfFalse)
+	c.emit(span, OpPop)
+	c.statement(s.Body)
+
+	for _, jump := range l.continues {
+		c.patchJump(jump)
+	}
+	if s.Increment != nil {
+		c.expression(s.Increment)
+		c.emit(span, OpPop)
+	}
+	c.emitLoop(span, start)
+
+	c.patchJump(exitJump)
+	c.emit(span, OpPop)
+	for _, jump := range l.breaks {
+		c.patchJump(jump)
+	}
+
+	c.current.loops = c.current.loops[:len(c.current.loops)-1]
+}
+
+func (c *Compiler) breakStatement(s *stmt.Break) {
+	l := c.current.loops[len(c.current.loops)-1]
+	height := c.leave(s.Keyword.Span, l.tryCount)
+	c.emitPops(s.Keyword.Span, height, l.localCount)
+	l.breaks = append(l.breaks, c.emitJump(s.Keyword.Span, OpJump))
+}
+
+func (c *Compiler) continueStatement(s *stmt.Continue) {
+	l := c.current.loops[len(c.current.loops)-1]
+	height := c.leave(s.Keyword.Span, l.tryCount)
+	c.emitPops(s.Keyword.Span, height, l.localCount)
+	l.continues = append(l.continues, c.emitJump(s.Keyword.Span, OpJump))
+}
+
+func (c *Compiler) returnStatement(s *stmt.Return) {
+	span := s.Keyword.Span
+	switch {
+	case c.current.kind == function.INITIALIZER:
+		c.emitBytes(span, byte(OpGetLocal), 0)
+	case s.Value != nil:
+		c.expression(s.Value)
+	default:
+		c.emit(span, OpNil)
+	}
+
+	if len(c.current.tries) == 0 {
+		c.emit(span, OpReturn)
+		return
+	}
+
+	// the value is kept aside while the finally blocks run, which can return a value themselves
+	c.emit(span, OpSetReturn)
+	c.leave(span, 0)
+	c.emit(span, OpReturnPending)
+}
+
+// leave pops the exception handlers and runs copies of the finally blocks of the try statements
+// entered since tryCount, innermost first. The locals of the try statements are popped, the
+// number of locals remaining on the stack is returned.
+func (c *Compiler) leave(span token.Span, tryCount int) int {
+	height := len(c.current.locals)
+	for i := len(c.current.tries) - 1; i >= tryCount; i-- {
+		t := c.current.tries[i]
+		c.emitPops(span, height, t.localCount)
+		height = t.localCount
+		if t.handler {
+			c.emit(span, OpEndTry)
+		}
+		if t.finally != nil {
+			c.finally(t, i)
+		}
+	}
+
+	return height
+}
+
+// finally compiles a copy of the finally block of the try statement at index, with the state at
+// the start of the try statement as the block can't see what's declared inside of it.
+func (c *Compiler) finally(t *try, index int) {
+	state := c.current
+	locals, loops, tries, scopeDepth := state.locals, state.loops, state.tries, state.scopeDepth
+
+	state.locals = append([]local{}, locals[:t.localCount]...)
+	state.tries = tries[:index]
+	state.loops = nil
+	for _, l := range loops {
+		if l.tryCount <= index {
+			state.loops = append(state.loops, l)
+		}
+	}
+
+	c.beginScope()
+	c.statements(t.finally)
+	c.endScope(token.Span{})
+
+	// captured flags set by closures in the copy belong to the locals of the try statement
+	for i := range state.locals {
+		locals[i].captured = locals[i].captured || state.locals[i].captured
+	}
+	state.locals, state.loops, state.tries, state.scopeDepth = locals, loops, tries, scopeDepth
+}
+
+// tryStatement pushes an exception handler for the body. If an exception is thrown, the stack is
+// reset to its height at the start of the statement and the exception is pushed. A second handler
+// protects the catch clause if there is a finally block, which then runs before rethrowing.
+func (c *Compiler) tryStatement(s *stmt.Try) {
+	span := s.Keyword.Span
+	t := &try{localCount: len(c.current.locals), handler: true, finally: s.FinallyBody}
+
+	c.current.tries = append(c.current.tries, t)
+	handler := c.emitJump(span, OpTry)
+	c.beginScope()
+	c.statements(s.Body)
+	c.endScope(span)
+	c.emit(span, OpEndTry)
+	c.current.tries = c.current.tries[:len(c.current.tries)-1]
+	index := len(c.current.tries)
+	if t.finally != nil {
+		c.finally(t, index)
+	}
+	ends := []int{c.emitJump(span, OpJump)}
+
+	c.patchJump(handler)
+	if s.CatchName != nil {
+		c.beginScope()
+		c.emit(s.CatchName.Span, OpCatch)
+		c.addLocal(*s.CatchName)
+
+		var catchHandler int
+		if t.finally != nil {
+			c.current.tries = append(c.current.tries, t)
+			catchHandler = c.emitJump(span, OpTry)
+		}
+
+		c.statements(s.CatchBody)
+
+		if t.finally != nil {
+			c.emit(span, OpEndTry)
+			c.current.tries = c.current.tries[:len(c.current.tries)-1]
+		}
+		c.endScope(span)
+
+		if t.finally == nil {
+			c.patchJumps(ends)
+			return
+		}
+
+		c.finally(t, index)
+		ends = append(ends, c.emitJump(span, OpJump))
+
+		// the stack holds the caught exception and the one thrown by the catch clause
+		c.patchJump(catchHandler)
+		c.rethrowAfterFinally(span, t, index, 2)
+	} else {
+		c.rethrowAfterFinally(span, t, index, 1)
+	}
+
+	c.patchJumps(ends)
+}
+
+// rethrowAfterFinally runs the finally block with the exception on top of the stack, which is
+// rethrown unless the block returns, breaks or continues. values is the number of values on the
+// stack since the start of the try statement.
+func (c *Compiler) rethrowAfterFinally(span token.Span, t *try, index int, values int) {
+	c.beginScope()
+	for i := 0; i < values; i++ {
+		c.current.locals = append(c.current.locals, local{depth: c.current.scopeDepth})
+	}
+	t.localCount += values
+	c.finally(t, index)
+	t.localCount -= values
+	c.emit(span, OpRethrow)
+
+	// nothing runs after the rethrow, the values are discarded without popping them
+	c.current.locals = c.current.locals[:len(c.current.locals)-values]
+	c.current.scopeDepth--
+}
+
+func (c *Compiler) classStatement(s *stmt.Class) {
+	span := s.Name.Span
+	// the class is reloaded by name, the resolution of the declaration is needed for that
+	class := expr.Resolution{Local: c.current.scopeDepth > 0}
+	c.emitConstantOp(span, OpClass, s.Name.Lexeme)
+	c.declareVariable(s.Name)
+	c.defineVariable(s.Name)
+
+	if s.Superclass != nil {
+		c.variable(s.Superclass.Name, s.Superclass.Resolution)
+
+		// methods capture the superclass as upvalue
+		c.beginScope()
+		c.current.locals = append(c.current.locals, local{name: "super", depth: c.current.scopeDepth})
+
+		c.variable(s.Name, class)
+		c.emit(s.Superclass.Name.Span, OpInherit)
+	}
+
+	c.variable(s.Name, class)
+	for _, method := range s.Methods {
+		kind := function.METHOD
+		if method.Name.Lexeme == "init" {
+			kind = function.INITIALIZER
+		}
+
+		c.function(method, kind, s.Name.Lexeme)
+		c.emitConstantOp(method.Name.Span, OpMethod, method.Name.Lexeme)
+	}
+	c.emit(span, OpPop)
+
+	if s.Superclass != nil {
+		c.endScope(span)
+	}
+}
+
+// function compiles the declaration and emits the creation of its closure.
+func (c *Compiler) function(declaration *stmt.Function, kind function.Type, class string) {
+	f := &Function{
+		Name:  declaration.Name.Lexeme,
+		Line:  declaration.Name.Line,
+		Arity: len(declaration.Params),
+	}
+	if declaration.Name.Type != token.IDENTIFIER {
+		// lambdas are named after their "fun" or "=>" token
+		f.Name = "anonymous"
+		f.Anonymous = true
+	}
+	if kind == function.METHOD || kind == function.INITIALIZER {
+		f.Class = class
+	}
+
+	slotZero := local{}
+	if f.Class != "" {
+		slotZero.name = "this"
+	}
+
+	state := &functionState{
+		enclosing:  c.current,
+		function:   f,
+		kind:       kind,
+		locals:     []local{slotZero},
+		scopeDepth: 1,
+	}
+	c.current = state
+
+	for _, param := range declaration.Params {
+		c.addLocal(param)
+	}
+	c.statements(declaration.Body)
+	c.emitReturn(declaration.Name.Span)
+
+	c.current = state.enclosing
+	f.UpvalueCount = len(state.upvalues)
+
+	span := declaration.Name.Span
+	c.emitConstantOp(span, OpClosure, f)
+	for _, upvalue := range state.upvalues {
+		isLocal := byte(0)
+		if upvalue.isLocal {
+			isLocal = 1
+		}
+		c.emitBytes(span, isLocal, byte(upvalue.index>>8), byte(upvalue.index))
+	}
+}
+
+func (c *Compiler) expression(expression expr.Expr) {
+	switch e := expression.(type) {
+	case *expr.Binary:
+		c.expression(e.Left)
+		c.expression(e.Right)
+		c.emit(e.Operator.Span, binaryOps[e.Operator.Type])
+	case *expr.Logical:
+		c.expression(e.Left)
+		span := e.Operator.Span
+		if e.Operator.Type == token.OR {
+			elseJump := c.emitJump(span, OpJumpIfFalse)
+			endJump := c.emitJump(span, OpJump)
+			c.patchJump(elseJump)
+			c.emit(span, OpPop)
+			c.expression(e.Right)
+			c.patchJump(endJump)
+		} else {
+			endJump := c.emitJump(span, OpJumpIfFalse)
+			c.emit(span, OpPop)
+			c.expression(e.Right)
+			c.patchJump(endJump)
+		}
+	case *expr.Grouping:
+		c.expression(e.Expression)
+	case *expr.Unary:
+		c.expression(e.Right)
+		if e.Operator.Type == token.MINUS {
+			c.emit(e.Operator.Span, OpNegate)
+		} else {
+			c.emit(e.Operator.Span, OpNot)
+		}
+	case *expr.Literal:
+		span := e.Span()
+		switch e.Value {
+		case nil:
+			c.emit(span, OpNil)
+		case true:
+			c.emit(span, OpTrue)
+		case false:
+			c.emit(span, OpFalse)
+		default:
+			c.emitConstantOp(span, OpConstant, e.Value)
+		}
+	case *expr.Variable:
+		c.variable(e.Name, e.Resolution)
+	case *expr.Assign:
+		c.expression(e.Value)
+		c.assign(e.Name, e.Resolution)
+	case *expr.Call:
+		c.call(e)
+	case *expr.Get:
+		c.expression(e.Object)
+		c.source(e.Object)
+		c.emitConstantOp(e.Name.Span, OpGetProperty, e.Name.Lexeme)
+	case *expr.Set:
+		c.expression(e.Object)
+		c.expression(e.Value)
+		c.source(e.Object)
+		c.emitConstantOp(e.Name.Span, OpSetProperty, e.Name.Lexeme)
+	case *expr.List:
+		for _, element := range e.Elements {
+			c.expression(element)
+		}
+		c.emitLongOp(e.Bracket.Span, OpList, len(e.Elements))
+	case *expr.Function:
+		c.function(e.Declaration.(*stmt.Function), function.FUNCTION, "")
+	case *expr.Interpolation:
+		for _, part := range e.Parts {
+			c.expression(part)
+		}
+		c.emitLongOp(e.Span(), OpInterpolate, len(e.Parts))
+	case *expr.Map:
+		for idx, key := range e.Keys {
+			c.expression(key)
+			c.expression(e.Values[idx])
+		}
+		c.emitLongOp(e.Brace.Span, OpMap, len(e.Keys))
+	case *expr.Index:
+		c.expression(e.Object)
+		c.expression(e.Index)
+		c.emit(e.Bracket.Span, OpGetIndex)
+	case *expr.IndexSet:
+		c.expression(e.Object)
+		c.expression(e.Index)
+		c.expression(e.Value)
+		c.emit(e.Bracket.Span, OpSetIndex)
+	case *expr.This:
+		c.variable(e.Keyword, e.Resolution)
+	case *expr.Super:
+		c.variable(token.Token{Lexeme: "this", Span: e.Keyword.Span}, expr.Resolution{Local: true})
+		c.variable(e.Keyword, e.Resolution)
+		c.emitConstantOp(e.Method.Span, OpGetSuper, e.Method.Lexeme)
+	default:
+		panic(fmt.Sprintf("Unhandled expr %#v", expression))
+	}
+}
+
+var binaryOps = map[token.TokenType]OpCode{
+	token.BANG_EQUAL:    OpNotEqual,
+	token.EQUAL_EQUAL:   OpEqual,
+	token.GREATER:       OpGreater,
+	token.GREATER_EQUAL: OpGreaterEqual,
+	token.LESS:          OpLess,
+	token.LESS_EQUAL:    OpLessEqual,
+	token.MINUS:         OpSubtract,
+	token.PLUS:          OpAdd,
+	token.SLASH:         OpDivide,
+	token.STAR:          OpMultiply,
+}
+
+// call invokes methods directly, without creating a bound method first.
+func (c *Compiler) call(e *expr.Call) {
+	span := e.ClosingParen.Span
+
+	switch callee := e.Callee.(type) {
+	case *expr.Get:
+		c.expression(callee.Object)
+		c.arguments(e.Arguments)
+		c.source(callee.Object)
+		// the argument count has the span of the call for errors of the call itself
+		c.emitConstantOp(callee.Name.Span, OpInvoke, callee.Name.Lexeme)
+		c.emitBytes(span, byte(len(e.Arguments)))
+	case *expr.Super:
+		c.variable(token.Token{Lexeme: "this", Span: callee.Keyword.Span}, expr.Resolution{Local: true})
+		c.arguments(e.Arguments)
+		c.variable(callee.Keyword, callee.Resolution)
+		c.emitConstantOp(callee.Method.Span, OpSuperInvoke, callee.Method.Lexeme)
+		c.emitBytes(span, byte(len(e.Arguments)))
+	default:
+		c.expression(e.Callee)
+		c.arguments(e.Arguments)
+		c.source(e.Callee)
+		c.emitBytes(span, byte(OpCall), byte(len(e.Arguments)))
+	}
+}
+
+func (c *Compiler) arguments(arguments []expr.Expr) {
+	for _, argument := range arguments {
+		c.expression(argument)
+	}
+}
+
+// source records the source code of the expression for error messages of the next instruction.
+func (c *Compiler) source(expression expr.Expr) {
+	chunk := c.chunk()
+	if chunk.sources == nil {
+		chunk.sources = map[int]string{}
+	}
+
+	chunk.sources[len(chunk.Code)] = expression.String()
+}
+
+func (c *Compiler) variable(name token.Token, resolution expr.Resolution) {
+	op, arg := c.resolve(name, resolution, OpGetLocal, OpGetUpvalue, OpGetGlobal)
+	c.emitVariableOp(name.Span, op, arg)
+}
+
+func (c *Compiler) assign(name token.Token, resolution expr.Resolution) {
+	op, arg := c.resolve(name, resolution, OpSetLocal, OpSetUpvalue, OpSetGlobal)
+	c.emitVariableOp(name.Span, op, arg)
+}
+
+// resolve picks the instruction accessing the variable and its operand.
+func (c *Compiler) resolve(name token.Token, resolution expr.Resolution, local, upvalue, global OpCode) (OpCode, int) {
+	if resolution.Local {
+		if slot := resolveLocal(c.current, name.Lexeme); slot != -1 {
+			return local, slot
+		}
+		if index := c.resolveUpvalue(c.current, name); index != -1 {
+			return upvalue, index
+		}
+	}
+
+	return global, c.makeConstant(name.Span, name.Lexeme)
+}
+
+func (c *Compiler) emitVariableOp(span token.Span, op OpCode, arg int) {
+	switch {
+	case op == OpGetGlobal || op == OpSetGlobal || op == OpDefineGlobal:
+		c.emitLongOp(span, op, arg)
+	case arg > 0xff:
+		c.emitBytes(span, byte(longOps[op]), byte(arg>>8), byte(arg))
+	default:
+		c.emitBytes(span, byte(op), byte(arg))
+	}
+}
+
+func resolveLocal(state *functionState, name string) int {
+	for i := len(state.locals) - 1; i >= 0; i-- {
+		if state.locals[i].name == name {
+			return i
+		}
+	}
+
+	return -1
+}
+
+func (c *Compiler) resolveUpvalue(state *functionState, name token.Token) int {
+	if state.enclosing == nil {
+		return -1
+	}
+
+	if slot := resolveLocal(state.enclosing, name.Lexeme); slot != -1 {
+		state.enclosing.locals[slot].captured = true
+		return c.addUpvalue(state, name, slot, true)
+	}
+
+	if index := c.resolveUpvalue(state.enclosing, name); index != -1 {
+		return c.addUpvalue(state, name, index, false)
+	}
+
+	return -1
+}
+
+func (c *Compiler) addUpvalue(state *functionState, name token.Token, index int, isLocal bool) int {
+	for i, upvalue := range state.upvalues {
+		if upvalue.index == index && upvalue.isLocal == isLocal {
+			return i
+		}
+	}
+
+	if len(state.upvalues) == maxUpvalues {
+		c.error(name, "Too many closure variables in function")
+		return 0
+	}
+
+	state.upvalues = append(state.upvalues, upvalue{index: index, isLocal: isLocal})
+	return len(state.upvalues) - 1
+}
+
+// declareVariable adds a local for the value on top of the stack, globals are defined by name.
+func (c *Compiler) declareVariable(name token.Token) {
+	if c.current.scopeDepth == 0 {
+		return
+	}
+
+	c.addLocal(name)
+}
+
+func (c *Compiler) defineVariable(name token.Token) {
+	if c.current.scopeDepth > 0 {
+		return
+	}
+
+	c.emitLongOp(name.Span, OpDefineGlobal, c.makeConstant(name.Span, name.Lexeme))
+}
+
+func (c *Compiler) addLocal(name token.Token) {
+	if len(c.current.locals) == maxLocals {
+		c.error(name, "Too many local variables in function")
+		return
+	}
+
+	c.current.locals = append(c.current.locals, local{name: name.Lexeme, depth: c.current.scopeDepth})
+}
+
+func (c *Compiler) beginScope() {
+	c.current.scopeDepth++
+}
+
+// endScope pops the locals of the scope, captured ones are moved into their upvalues.
+func (c *Compiler) endScope(span token.Span) {
+	state := c.current
+	state.scopeDepth--
+
+	for len(state.locals) > 0 && state.locals[len(state.locals)-1].depth > state.scopeDepth {
+		if state.locals[len(state.locals)-1].captured {
+			c.emit(span, OpCloseUpvalue)
+		} else {
+			c.emit(span, OpPop)
+		}
+		state.locals = state.locals[:len(state.locals)-1]
+	}
+}
+
+// emitPops pops the locals from height down to localCount without removing them from the scope,
+// as the code following a jump still uses them. Whether a local will be captured isn't known yet,
+// so the upvalues are closed in any case.
+func (c *Compiler) emitPops(span token.Span, height, localCount int) {
+	for i := height; i > localCount; i-- {
+		c.emit(span, OpCloseUpvalue)
+	}
+}
+
+func (c *Compiler) emitReturn(span token.Span) {
+	if c.current.kind == function.INITIALIZER {
+		c.emitBytes(span, byte(OpGetLocal), 0)
+	} else {
+		c.emit(span, OpNil)
+	}
+
+	c.emit(span, OpReturn)
+}
+
+func (c *Compiler) chunk() *Chunk {
+	return &c.current.function.Chunk
+}
+
+func (c *Compiler) emit(span token.Span, op OpCode) {
+	c.chunk().write(byte(op), span)
+}
+
+func (c *Compiler) emitBytes(span token.Span, bytes ...byte) {
+	for _, b := range bytes {
+		c.chunk().write(b, span)
+	}
+}
+
+func (c *Compiler) emitLongOp(span token.Span, op OpCode, operand int) {
+	if operand > maxLong {
+		c.error(token.Token{Span: span}, fmt.Sprintf("Too many operands for %s", op))
+	}
+
+	c.emitBytes(span, byte(op), byte(operand>>16), byte(operand>>8), byte(operand))
+}
+
+func (c *Compiler) emitConstantOp(span token.Span, op OpCode, value interface{}) {
+	c.emitLongOp(span, op, c.makeConstant(span, value))
+}
+
+// makeConstant adds the value to the constant pool, numbers and strings are only added once.
+func (c *Compiler) makeConstant(span token.Span, value interface{}) int {
+	chunk := c.chunk()
+	if index, ok := c.current.constants[value]; ok {
+		return index
+	}
+
+	if len(chunk.Constants) == maxConstants {
+		c.error(token.Token{Span: span}, "Too many constants in one chunk")
+		return 0
+	}
+
+	chunk.Constants = append(chunk.Constants, value)
+	if _, ok := value.(*Function); !ok {
+		if c.current.constants == nil {
+			c.current.constants = map[interface{}]int{}
+		}
+		c.current.constants[value] = len(chunk.Constants) - 1
+	}
+	return len(chunk.Constants) - 1
+}
+
+// emitJump returns the offset of the jump's operand, which is patched once the target is known.
+func (c *Compiler) emitJump(span token.Span, op OpCode) int {
+	c.emitBytes(span, byte(op), 0xff, 0xff, 0xff)
+	return len(c.chunk().Code) - 3
+}
+
+func (c *Compiler) patchJump(offset int) {
+	chunk := c.chunk()
+	jump := len(chunk.Code) - offset - 3
+	if jump > maxLong {
+		c.error(token.Token{Span: chunk.Span(offset)}, "Too much code to jump over")
+	}
+
+	chunk.Code[offset] = byte(jump >> 16)
+	chunk.Code[offset+1] = byte(jump >> 8)
+	chunk.Code[offset+2] = byte(jump)
+}
+
+func (c *Compiler) patchJumps(offsets []int) {
+	for _, offset := range offsets {
+		c.patchJump(offset)
+	}
+}
+
+func (c *Compiler) emitLoop(span token.Span, start int) {
+	c.emit(span, OpLoop)
+
+	offset := len(c.chunk().Code) - start + 3
+	if offset > maxLong {
+		c.error(token.Token{Span: span}, "Loop body too large")
+	}
+
+	c.emitBytes(span, byte(offset>>16), byte(offset>>8), byte(offset))
+}
+
+func (c *Compiler) error(tok token.Token, message string) {
+	c.hasError = true
+
+	where := ""
+	if tok.Lexeme != "" {
+		where = fmt.Sprintf(" at '%s'", tok.Lexeme)
+	}
+	c.reporter.Report(tok.Span, where, message)
+}
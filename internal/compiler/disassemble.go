@@ -0,0 +1,99 @@
+package compiler
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Disassemble lists the instructions of the function and of the functions nested in it.
+func Disassemble(function *Function) string {
+	var b strings.Builder
+	disassemble(&b, function)
+
+	return b.String()
+}
+
+func disassemble(b *strings.Builder, function *Function) {
+	chunk := &function.Chunk
+	if function.Class != "" {
+		fmt.Fprintf(b, "== %s.%s ==\n", function.Class, function.Name)
+	} else {
+		fmt.Fprintf(b, "== %s ==\n", strings.Trim(function.String(), "<>"))
+	}
+
+	var nested []*Function
+	line := -1
+	for offset := 0; offset < len(chunk.Code); {
+		op := OpCode(chunk.Code[offset])
+
+		if span := chunk.Span(offset); span.Line != line {
+			line = span.Line
+			fmt.Fprintf(b, "%04d %4d %s", offset, line, op)
+		} else {
+			fmt.Fprintf(b, "%04d    | %s", offset, op)
+		}
+
+		var operands string
+		switch op {
+		case OpConstant, OpGetGlobal, OpDefineGlobal, OpSetGlobal, OpGetProperty, OpSetProperty,
+			OpGetSuper, OpClass, OpMethod, OpImport:
+			operands = formatConstant(chunk.Constants[chunk.ReadLong(offset+1)])
+			offset += 4
+		case OpGetLocal, OpSetLocal, OpGetUpvalue, OpSetUpvalue, OpCall:
+			operands = fmt.Sprint(chunk.Code[offset+1])
+			offset += 2
+		case OpGetLocalLong, OpSetLocalLong, OpGetUpvalueLong, OpSetUpvalueLong:
+			operands = fmt.Sprint(chunk.ReadShort(offset + 1))
+			offset += 3
+		case OpInvoke, OpSuperInvoke:
+			constant := chunk.Constants[chunk.ReadLong(offset+1)]
+			operands = fmt.Sprintf("%s (%d args)", formatConstant(constant), chunk.Code[offset+4])
+			offset += 5
+		case OpJump, OpJumpIfFalse, OpTry:
+			operands = fmt.Sprintf("-> %04d", offset+4+chunk.ReadLong(offset+1))
+			offset += 4
+		case OpLoop:
+			operands = fmt.Sprintf("-> %04d", offset+4-chunk.ReadLong(offset+1))
+			offset += 4
+		case OpList, OpMap, OpInterpolate:
+			operands = fmt.Sprint(chunk.ReadLong(offset + 1))
+			offset += 4
+		case OpClosure:
+			function := chunk.Constants[chunk.ReadLong(offset+1)].(*Function)
+			nested = append(nested, function)
+			operands = function.String()
+			offset += 4
+		default:
+			offset++
+		}
+
+		if operands != "" {
+			fmt.Fprintf(b, "%*s%s", 17-len(op.String()), "", operands)
+		}
+		b.WriteString("\n")
+
+		if op == OpClosure {
+			for i := 0; i < nested[len(nested)-1].UpvalueCount; i++ {
+				kind := "upvalue"
+				if chunk.Code[offset] == 1 {
+					kind = "local"
+				}
+				fmt.Fprintf(b, "%04d    |   %s %d\n", offset, kind, chunk.ReadShort(offset+1))
+				offset += 3
+			}
+		}
+	}
+
+	for _, function := range nested {
+		b.WriteString("\n")
+		disassemble(b, function)
+	}
+}
+
+func formatConstant(constant interface{}) string {
+	if s, ok := constant.(string); ok {
+		return fmt.Sprintf("%q", s)
+	}
+
+	return fmt.Sprintf("%v", constant)
+}
@@ -0,0 +1,25 @@
+package compiler
+
+import "fmt"
+
+// Function is a compiled function declaration, lambda or script. The VM creates closures of it.
+type Function struct {
+	Name         string // empty for scripts
+	Class        string // of methods, empty otherwise
+	Anonymous    bool   // lambdas are named after the line they are declared in
+	Line         int
+	Arity        int
+	UpvalueCount int
+	Chunk        Chunk
+}
+
+func (f *Function) String() string {
+	switch {
+	case f.Name == "":
+		return "<script>"
+	case f.Anonymous:
+		return fmt.Sprintf("<fn anonymous@line %d>", f.Line)
+	}
+
+	return fmt.Sprintf("<fn %s>", f.Name)
+}
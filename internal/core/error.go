@@ -0,0 +1,23 @@
+package core
+
+// ErrorClass is the name of the class of the error objects runtime errors get converted to when
+// caught.
+const ErrorClass = "RuntimeError"
+
+// ErrorFields are the fields of the error object of a runtime error.
+func ErrorFields(message string, line int) map[string]interface{} {
+	return map[string]interface{}{
+		"message": message,
+		"line":    float64(line),
+	}
+}
+
+// ExceptionMessage describes an uncaught thrown value, fields are its fields if it's an instance.
+// The message of error objects is preferred, so rethrown runtime errors keep it.
+func ExceptionMessage(value interface{}, fields map[string]interface{}) string {
+	if message, ok := fields["message"].(string); ok {
+		return message
+	}
+
+	return Stringify(value)
+}
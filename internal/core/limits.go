@@ -0,0 +1,96 @@
+package core
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	ErrStepLimit = errors.New("step limit exceeded")
+	ErrTimeout   = errors.New("timeout exceeded")
+	ErrCancelled = errors.New("execution cancelled")
+)
+
+// limitCheckInterval is the number of steps between checks of the timeout and the context,
+// which are too expensive to check on every step.
+const limitCheckInterval = 1024
+
+// Limits bound the execution of untrusted code. What a step is depends on the backend, a
+// statement or an expression for the interpreter and an instruction for the vm.
+type Limits struct {
+	MaxSteps      int           // 0 for no limit
+	Timeout       time.Duration // 0 for no limit
+	Ctx           context.Context
+	MaxAllocation int // in bytes, 0 for no limit
+
+	running   bool
+	steps     int
+	deadline  time.Time
+	exceeded  *Exceeded // nil until a limit is exceeded
+	allocated int       // bytes allocated so far
+}
+
+// Exceeded describes the exceeded limit, Err is ErrStepLimit, ErrTimeout or ErrCancelled.
+type Exceeded struct {
+	Message string
+	Err     error
+}
+
+// Start resets the step count and the deadline unless the execution is already running, like
+// when a native calls back into Lox. The returned function ends the execution.
+func (l *Limits) Start() (stop func()) {
+	if l.running {
+		return func() {}
+	}
+
+	l.running = true
+	l.steps = 0
+	l.allocated = 0
+	l.exceeded = nil
+	if l.Timeout > 0 {
+		l.deadline = time.Now().Add(l.Timeout)
+	}
+
+	return func() {
+		l.running = false
+	}
+}
+
+// Step counts a step and returns the exceeded limit, once exceeded it's returned for every
+// following step.
+func (l *Limits) Step() *Exceeded {
+	l.steps++
+
+	if l.exceeded != nil {
+		return l.exceeded
+	}
+
+	switch {
+	case l.MaxSteps > 0 && l.steps > l.MaxSteps:
+		l.exceeded = &Exceeded{fmt.Sprintf("Step limit of %d exceeded", l.MaxSteps), ErrStepLimit}
+	case (l.steps-1)%limitCheckInterval != 0: // checks on the first step and every interval
+	case l.Timeout > 0 && time.Now().After(l.deadline):
+		l.exceeded = &Exceeded{fmt.Sprintf("Timeout of %s exceeded", l.Timeout), ErrTimeout}
+	case l.Ctx != nil && l.Ctx.Err() != nil:
+		l.exceeded = &Exceeded{fmt.Sprintf("Execution cancelled: %s", context.Cause(l.Ctx)), ErrCancelled}
+	}
+
+	return l.exceeded
+}
+
+// Allocate accounts for size bytes about to be allocated. If that exceeds the allocation limit
+// an error is returned and the allocation isn't counted.
+func (l *Limits) Allocate(size int) error {
+	if l.MaxAllocation == 0 {
+		return nil
+	}
+
+	if l.allocated+size > l.MaxAllocation {
+		return fmt.Errorf("Allocation limit of %d bytes exceeded", l.MaxAllocation)
+	}
+
+	l.allocated += size
+	return nil
+}
@@ -0,0 +1,111 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fiurgeist/golox/internal/token"
+)
+
+// Loader caches the modules of imported files and detects cyclic imports, it's shared by all
+// files of a program. Modules are opaque to it, each backend has its own.
+type Loader struct {
+	cache   map[string]interface{}
+	loading []string // chain of imports currently being executed, to detect cycles
+}
+
+func NewLoader() *Loader {
+	return &Loader{cache: map[string]interface{}{}}
+}
+
+// Load returns the module of the file at path, which is relative to the importing file, or the
+// working directory if importer is empty. A file is read and given to load with its absolute path
+// only on its first import, runtime errors raised by load propagate to the importing file.
+func (l *Loader) Load(
+	importer, path string,
+	load func(path string, source *token.Source) (interface{}, error),
+) (interface{}, error) {
+	path, err := absolutePath(importer, path)
+	if err != nil {
+		return nil, fmt.Errorf("Invalid module path: %s", err)
+	}
+
+	if module, ok := l.cache[path]; ok {
+		return module, nil
+	}
+
+	for idx, loading := range l.loading {
+		if loading == path {
+			chain := append(append([]string{}, l.loading[idx:]...), path)
+			for j := range chain {
+				chain[j] = DisplayPath(chain[j])
+			}
+			return nil, fmt.Errorf("Cyclic import %s", strings.Join(chain, " -> "))
+		}
+	}
+
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("Can't read module: %s", err)
+	}
+
+	defer l.enter(path)()
+
+	module, err := load(path, &token.Source{Path: DisplayPath(path), Code: code})
+	if err != nil {
+		return nil, err
+	}
+
+	l.cache[path] = module
+	return module, nil
+}
+
+// Enter marks the script at path as being executed until the returned function is called, so it
+// is part of the import chain of the files it imports and importing it again is reported as a
+// cyclic import. Scripts without a path, like code run in the REPL, aren't marked.
+func (l *Loader) Enter(path string) func() {
+	if path == "" {
+		return func() {}
+	}
+
+	path, err := absolutePath("", path)
+	if err != nil {
+		return func() {}
+	}
+
+	return l.enter(path)
+}
+
+// enter adds the absolute path to the import chain, the returned function removes it.
+func (l *Loader) enter(path string) func() {
+	l.loading = append(l.loading, path)
+
+	return func() {
+		l.loading = l.loading[:len(l.loading)-1]
+	}
+}
+
+// absolutePath resolves path relative to the directory of importer.
+func absolutePath(importer, path string) (string, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(importer), path)
+	}
+
+	return filepath.Abs(path)
+}
+
+// DisplayPath shortens path relative to the working directory if possible.
+func DisplayPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+
+	if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+
+	return path
+}
@@ -0,0 +1,217 @@
+// Package core holds what the tree-walking interpreter and the vm share: the list and map values,
+// how values are printed and checked, the limits of an execution and the loading of modules.
+// Errors are returned, each backend raises them at its own location.
+package core
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// TypeOf names the Lox type of a value, each backend knows the types of its own objects.
+type TypeOf func(value interface{}) string
+
+type List struct {
+	Elements []interface{}
+}
+
+func NewList(elements []interface{}) *List {
+	return &List{Elements: elements}
+}
+
+func (l *List) String() string {
+	return l.format(map[interface{}]bool{})
+}
+
+func (l *List) format(visiting map[interface{}]bool) string {
+	if visiting[l] {
+		return "[...]"
+	}
+	visiting[l] = true
+	defer delete(visiting, l)
+
+	elements := make([]string, len(l.Elements))
+	for i, element := range l.Elements {
+		elements[i] = quoteNested(element, visiting)
+	}
+
+	return fmt.Sprintf("[%s]", strings.Join(elements, ", "))
+}
+
+// Map keeps its keys in insertion order, so iterating over keys() and
+// values() as well as printing a map is deterministic. Keys have to pass
+// CheckHashable.
+type Map struct {
+	keys    []interface{}
+	entries map[interface{}]interface{}
+}
+
+func NewMap() *Map {
+	return &Map{entries: map[interface{}]interface{}{}}
+}
+
+func (m *Map) Get(key interface{}) (interface{}, error) {
+	if value, ok := m.entries[key]; ok {
+		return value, nil
+	}
+
+	return nil, fmt.Errorf("Undefined key %s", Quote(key))
+}
+
+func (m *Map) Set(key interface{}, value interface{}) {
+	if _, ok := m.entries[key]; !ok {
+		m.keys = append(m.keys, key)
+	}
+
+	m.entries[key] = value
+}
+
+func (m *Map) Has(key interface{}) bool {
+	_, ok := m.entries[key]
+	return ok
+}
+
+func (m *Map) Remove(key interface{}) interface{} {
+	value, ok := m.entries[key]
+	if !ok {
+		return nil
+	}
+
+	delete(m.entries, key)
+	for i, k := range m.keys {
+		if k == key {
+			m.keys = append(m.keys[:i], m.keys[i+1:]...)
+			break
+		}
+	}
+
+	return value
+}
+
+func (m *Map) Len() int {
+	return len(m.keys)
+}
+
+func (m *Map) Keys() []interface{} {
+	return append([]interface{}{}, m.keys...)
+}
+
+func (m *Map) Values() []interface{} {
+	values := make([]interface{}, len(m.keys))
+	for i, key := range m.keys {
+		values[i] = m.entries[key]
+	}
+
+	return values
+}
+
+func (m *Map) String() string {
+	return m.format(map[interface{}]bool{})
+}
+
+func (m *Map) format(visiting map[interface{}]bool) string {
+	if visiting[m] {
+		return "{...}"
+	}
+	visiting[m] = true
+	defer delete(visiting, m)
+
+	entries := make([]string, len(m.keys))
+	for i, key := range m.keys {
+		entries[i] = fmt.Sprintf("%s: %s", Quote(key), quoteNested(m.entries[key], visiting))
+	}
+
+	return fmt.Sprintf("{%s}", strings.Join(entries, ", "))
+}
+
+// CheckHashable restricts keys to values with a stable identity: numbers,
+// strings, Booleans, nil and instances (compared by reference). NaN isn't
+// equal to itself, so a NaN key could never be found again.
+func CheckHashable(key interface{}, typeOf TypeOf) error {
+	switch k := key.(type) {
+	case float64:
+		if math.IsNaN(k) {
+			return errors.New("Unhashable map key NaN")
+		}
+		return nil
+	case nil, string, bool:
+		return nil
+	}
+
+	if kind := typeOf(key); kind != "instance" {
+		return fmt.Errorf("Unhashable map key of type '%s'", kind)
+	}
+
+	return nil
+}
+
+// CheckIndex validates index as a subscript into a sequence of the given length.
+func CheckIndex(kind string, index interface{}, length int, typeOf TypeOf) (int, error) {
+	number, ok := index.(float64)
+	if !ok {
+		return 0, fmt.Errorf("%s index must be a number, got '%s'", kind, typeOf(index))
+	}
+
+	i := int(number)
+	if float64(i) != number {
+		return 0, fmt.Errorf("%s index must be an integer, got %v", kind, number)
+	}
+
+	if i < 0 || i >= length {
+		return 0, fmt.Errorf("%s index %d out of range for length %d", kind, i, length)
+	}
+
+	return i, nil
+}
+
+func IsTruthy(value interface{}) bool {
+	if value == nil {
+		return false
+	}
+
+	if b, ok := value.(bool); ok {
+		return b
+	}
+
+	return true
+}
+
+func Stringify(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return "nil"
+	case string:
+		return v
+	}
+	if c, ok := value.(interface{ String() string }); ok {
+		return c.String()
+	}
+
+	return fmt.Sprintf("%v", value)
+}
+
+// Quote is Stringify for values nested in a collection, where strings need
+// their quotes to be distinguishable from other values.
+func Quote(value interface{}) string {
+	return quoteNested(value, map[interface{}]bool{})
+}
+
+// collection is a value containing other values, which may contain the collection itself.
+type collection interface {
+	// format prints the collection, visiting holds the collections being printed around it
+	// and is used to print a collection containing itself as a placeholder.
+	format(visiting map[interface{}]bool) string
+}
+
+func quoteNested(value interface{}, visiting map[interface{}]bool) string {
+	switch v := value.(type) {
+	case string:
+		return fmt.Sprintf("%q", v)
+	case collection:
+		return v.format(visiting)
+	}
+
+	return Stringify(value)
+}
@@ -0,0 +1,35 @@
+package core
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCheckHashable(t *testing.T) {
+	typeOf := func(value interface{}) string {
+		if _, ok := value.(*List); ok {
+			return "list"
+		}
+		return "instance"
+	}
+
+	tests := []struct {
+		key  interface{}
+		want string
+	}{
+		{key: nil},
+		{key: 1.5},
+		{key: "key"},
+		{key: true},
+		{key: &struct{}{}},
+		{key: math.NaN(), want: "Unhashable map key NaN"},
+		{key: NewList(nil), want: "Unhashable map key of type 'list'"},
+	}
+
+	for _, test := range tests {
+		err := CheckHashable(test.key, typeOf)
+		if (err == nil && test.want != "") || (err != nil && err.Error() != test.want) {
+			t.Errorf("CheckHashable(%v) = %v, want %q", test.key, err, test.want)
+		}
+	}
+}
@@ -0,0 +1,61 @@
+package interpreter
+
+import (
+	"strings"
+
+	"github.com/fiurgeist/golox/internal/ast/stmt"
+	"github.com/fiurgeist/golox/internal/token"
+)
+
+// Approximate sizes in bytes of the allocations accounted for by the allocation limit.
+const (
+	valueSize       = 16 // of an interface{} in a list or a local variable slot
+	entrySize       = 48 // of a key and value in a Go map, like a global variable or a field
+	listSize        = 40
+	mapSize         = 64
+	instanceSize    = 64
+	environmentSize = 64
+	functionSize    = 64
+)
+
+// WithMaxAllocation limits the approximate number of bytes allocated for strings, instances,
+// environments, functions, lists and maps in total. It's a budget for the whole execution, not a
+// limit of the memory in use: memory that is garbage collected again isn't given back.
+func WithMaxAllocation(bytes int) Option {
+	return func(i *Interpreter) {
+		i.limit().MaxAllocation = bytes
+	}
+}
+
+// allocate accounts for size bytes about to be allocated at tok. Unlike the other limits, an
+// exceeded allocation limit is a RuntimeError scripts can catch, the failed allocation isn't
+// counted.
+func (i *Interpreter) allocate(tok token.Token, size int) {
+	if i.limits == nil {
+		return
+	}
+
+	if err := i.limits.Allocate(size); err != nil {
+		panic(NewRuntimeError(tok, err.Error()))
+	}
+}
+
+// allocateBlock accounts for the environment of a block. An empty block has no location for the
+// error and isn't counted.
+func (i *Interpreter) allocateBlock(statements []stmt.Stmt) {
+	if len(statements) != 0 {
+		i.allocate(token.Token{Span: statements[0].Span()}, environmentSize)
+	}
+}
+
+// join concatenates the parts of an interpolated string at tok, the string is accounted for
+// before it's built.
+func (i *Interpreter) join(tok token.Token, parts []string) string {
+	size := 0
+	for _, part := range parts {
+		size += len(part)
+	}
+	i.allocate(tok, size)
+
+	return strings.Join(parts, "")
+}
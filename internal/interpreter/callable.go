@@ -1,7 +1,9 @@
 package interpreter
 
+import "github.com/fiurgeist/golox/internal/token"
+
 type Callable interface {
-	Call(interpreter *Interpreter, arguments []interface{}) interface{}
+	Call(interpreter *Interpreter, paren token.Token, arguments []interface{}) interface{}
 	Arity() int
 	String() string
 }
@@ -0,0 +1,27 @@
+package interpreter
+
+import "github.com/fiurgeist/golox/internal/reporter"
+
+// callFrame is pushed for every call of a Lox function. Frames aren't popped when a runtime error
+// unwinds the stack, so the stack at the time of the error is still available when it's recovered.
+type callFrame struct {
+	function *Function
+	line     int // of the call in the calling frame
+}
+
+// stackTrace lists the frames of the call stack innermost first, starting at line.
+func (i *Interpreter) stackTrace(line int) []reporter.StackFrame {
+	trace := make([]reporter.StackFrame, 0, len(i.frames)+1)
+	for idx := len(i.frames) - 1; idx >= 0; idx-- {
+		frame := i.frames[idx]
+		stackFrame := reporter.StackFrame{Function: frame.function.name(), Line: line}
+		if frame.function.class != nil {
+			stackFrame.Class = frame.function.class.name
+		}
+
+		trace = append(trace, stackFrame)
+		line = frame.line
+	}
+
+	return append(trace, reporter.StackFrame{Line: line})
+}
@@ -2,6 +2,7 @@ package interpreter
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/fiurgeist/golox/internal/token"
 )
@@ -18,11 +19,12 @@ func NewClass(name string, superclass *Class, methods map[string]*Function) *Cla
 	return &Class{name: name, Superclass: superclass, methods: methods}
 }
 
-func (c *Class) Call(interpreter *Interpreter, arguments []interface{}) interface{} {
+func (c *Class) Call(interpreter *Interpreter, paren token.Token, arguments []interface{}) interface{} {
+	interpreter.allocate(paren, instanceSize)
 	instance := &Instance{class: c, fields: map[string]interface{}{}}
 
 	if initializer := c.findMethod("init"); initializer != nil {
-		initializer.bind(instance).Call(interpreter, arguments)
+		initializer.bind(instance).Call(interpreter, paren, arguments)
 	}
 
 	return instance
@@ -52,9 +54,19 @@ func (c *Class) String() string {
 	return c.name
 }
 
+// Object is a value with properties, accessed with expr.Get and expr.Set.
+type Object interface {
+	Get(name token.Token) interface{}
+	Set(name token.Token, value interface{})
+	Properties() []string // names of the properties in alphabetical order
+}
+
+var _ Object = (*Instance)(nil)
+
 type Instance struct {
 	class  *Class
 	fields map[string]interface{}
+	err    *RuntimeError // the caught runtime error of an error object
 }
 
 func (i *Instance) Get(name token.Token) interface{} {
@@ -73,6 +85,31 @@ func (i *Instance) Set(name token.Token, value interface{}) {
 	i.fields[name.Lexeme] = value
 }
 
+func (i *Instance) hasField(name string) bool {
+	_, ok := i.fields[name]
+	return ok
+}
+
+func (i *Instance) Properties() []string {
+	names := map[string]bool{}
+	for name := range i.fields {
+		names[name] = true
+	}
+	for class := i.class; class != nil; class = class.Superclass {
+		for name := range class.methods {
+			names[name] = true
+		}
+	}
+
+	properties := make([]string, 0, len(names))
+	for name := range names {
+		properties = append(properties, name)
+	}
+	sort.Strings(properties)
+
+	return properties
+}
+
 func (i *Instance) String() string {
 	return fmt.Sprintf("%s instance", i.class.name)
 }
@@ -0,0 +1,715 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/fiurgeist/golox/internal/ast/expr"
+	"github.com/fiurgeist/golox/internal/ast/stmt"
+	"github.com/fiurgeist/golox/internal/core"
+	"github.com/fiurgeist/golox/internal/token"
+)
+
+// WithClosureCompilation compiles the statements to Go closures before running them, instead of
+// walking the syntax tree. Each node is compiled once, so the type switches of execute and
+// evaluate are out of the way when a loop or a function runs again.
+func WithClosureCompilation() Option {
+	return func(i *Interpreter) {
+		i.compiled = true
+	}
+}
+
+// frame is the state compiled closures run in, one per function call or script.
+type frame struct {
+	interpreter *Interpreter
+	environment *Environment
+	returnValue interface{}
+}
+
+type (
+	evaluator func(f *frame) interface{}
+	executor  func(f *frame) completion
+)
+
+// compiledBody is the body of a function with the nesting its statements and expressions need.
+type compiledBody struct {
+	execute executor
+	nesting int
+}
+
+// completion tells how a compiled statement ended, loops and function calls consume it.
+type completion int
+
+const (
+	completedNormally completion = iota
+	completedBreak
+	completedContinue
+	completedReturn
+)
+
+// run compiles and executes the statements in the current environment.
+func (i *Interpreter) run(statements []stmt.Stmt) {
+	f := frame{interpreter: i, environment: i.environment}
+	i.compileBlock(statements)(&f)
+}
+
+func (i *Interpreter) compileBlock(statements []stmt.Stmt) executor {
+	executors := make([]executor, len(statements))
+	for idx, statement := range statements {
+		executors[idx] = i.compileStmt(statement)
+	}
+
+	if len(executors) == 1 {
+		return executors[0]
+	}
+
+	return func(f *frame) completion {
+		for _, execute := range executors {
+			if c := execute(f); c != completedNormally {
+				return c
+			}
+		}
+
+		return completedNormally
+	}
+}
+
+// compileStmt counts a step before the statement runs if there are limits, like execute.
+func (i *Interpreter) compileStmt(statement stmt.Stmt) executor {
+	execute := i.compileStmtNode(statement)
+	if i.limits == nil {
+		return execute
+	}
+
+	return func(f *frame) completion {
+		f.interpreter.step(statement)
+		return execute(f)
+	}
+}
+
+// compileFunctionBody measures the deepest nesting of the body while compiling it, which a call
+// adds to the nesting instead of counting it like execute and evaluate.
+func (i *Interpreter) compileFunctionBody(statements []stmt.Stmt) compiledBody {
+	nesting, maxNesting := i.compileNesting, i.compileMaxNesting
+	i.compileNesting, i.compileMaxNesting = 0, 0
+
+	body := compiledBody{execute: i.compileBlock(statements)}
+	body.nesting = i.compileMaxNesting
+
+	i.compileNesting, i.compileMaxNesting = nesting, maxNesting
+
+	return body
+}
+
+// nest counts the nesting of a statement or expression while it is compiled, the returned
+// function ends it.
+func (i *Interpreter) nest() func() {
+	i.compileNesting++
+	i.compileMaxNesting = max(i.compileMaxNesting, i.compileNesting)
+
+	return func() { i.compileNesting-- }
+}
+
+func (i *Interpreter) compileStmtNode(statement stmt.Stmt) executor {
+	defer i.nest()()
+
+	switch s := statement.(type) {
+	case *stmt.Print:
+		expression := i.compileExpr(s.Expression)
+		return func(f *frame) completion {
+			fmt.Fprintln(f.interpreter.output, core.Stringify(expression(f)))
+			return completedNormally
+		}
+	case *stmt.Var:
+		name := s.Name
+		initializer := func(f *frame) interface{} { return nil }
+		if s.Initializer != nil {
+			initializer = i.compileExpr(s.Initializer)
+		}
+
+		return func(f *frame) completion {
+			value := initializer(f)
+			f.interpreter.allocate(name, valueSize)
+			f.environment.Define(name.Lexeme, value)
+			return completedNormally
+		}
+	case *stmt.Expression:
+		expression := i.compileExpr(s.Expression)
+		return func(f *frame) completion {
+			expression(f)
+			return completedNormally
+		}
+	case *stmt.Block:
+		body := i.compileBlock(s.Statements)
+		return func(f *frame) completion {
+			f.interpreter.allocateBlock(s.Statements)
+			previous := f.environment
+			f.environment = NewEnclosedEnvironment(previous)
+			c := body(f)
+			f.environment = previous
+			return c
+		}
+	case *stmt.If:
+		condition := i.compileExpr(s.Condition)
+		thenBranch := i.compileStmt(s.ThenBranch)
+		if s.ElseBranch == nil {
+			return func(f *frame) completion {
+				if core.IsTruthy(condition(f)) {
+					return thenBranch(f)
+				}
+				return completedNormally
+			}
+		}
+
+		elseBranch := i.compileStmt(s.ElseBranch)
+		return func(f *frame) completion {
+			if core.IsTruthy(condition(f)) {
+				return thenBranch(f)
+			}
+			return elseBranch(f)
+		}
+	case *stmt.While:
+		condition := i.compileCountedExpr(s.Condition)
+		body := i.compileStmt(s.Body)
+		increment := func(f *frame) interface{} { return nil }
+		if s.Increment != nil {
+			increment = i.compileExpr(s.Increment)
+		}
+
+		return func(f *frame) completion {
+			for core.IsTruthy(condition(f)) {
+				switch body(f) {
+				case completedBreak:
+					return completedNormally
+				case completedReturn:
+					return completedReturn
+				}
+
+				increment(f)
+			}
+
+			return completedNormally
+		}
+	case *stmt.Break:
+		return func(f *frame) completion { return completedBreak }
+	case *stmt.Continue:
+		return func(f *frame) completion { return completedContinue }
+	case *stmt.Function:
+		body := i.compileFunctionBody(s.Body)
+		return func(f *frame) completion {
+			f.interpreter.allocate(s.Name, valueSize+functionSize)
+			f.environment.Define(s.Name.Lexeme, newCompiledFunction(s, body, f.environment, false))
+			return completedNormally
+		}
+	case *stmt.Return:
+		value := func(f *frame) interface{} { return nil }
+		if s.Value != nil {
+			value = i.compileExpr(s.Value)
+		}
+
+		return func(f *frame) completion {
+			f.returnValue = value(f)
+			return completedReturn
+		}
+	case *stmt.Import:
+		return func(f *frame) completion {
+			f.environment.Define(s.Name.Lexeme, f.interpreter.importModule(s))
+			return completedNormally
+		}
+	case *stmt.Throw:
+		value := i.compileExpr(s.Value)
+		return func(f *frame) completion {
+			panic(thrown(s.Keyword, value(f)))
+		}
+	case *stmt.Try:
+		return i.compileTry(s)
+	case *stmt.Class:
+		return i.compileClass(s)
+	default:
+		panic(fmt.Sprintf("Unhandled statement %#v", statement))
+	}
+}
+
+// compileTry has the semantics of executeTry, a pending return value stays in the frame while the
+// finally block runs.
+func (i *Interpreter) compileTry(s *stmt.Try) executor {
+	compiledBody := i.compileBlock(s.Body)
+	body := func(f *frame) completion {
+		f.interpreter.allocateBlock(s.Body)
+		return compiledBody(f)
+	}
+	catchBody := i.compileBlock(s.CatchBody)
+	var finallyBody executor
+	if s.FinallyBody != nil {
+		finallyBody = i.compileBlock(s.FinallyBody)
+	}
+
+	// runs in a new environment, which is left even if an exception is raised
+	block := func(f *frame, environment *Environment, body executor) (c completion, raised interface{}) {
+		previous := f.environment
+		raised = f.interpreter.protect(func() {
+			f.environment = environment
+			c = body(f)
+		})
+		f.environment = previous
+
+		return c, raised
+	}
+
+	return func(f *frame) completion {
+		c, raised := block(f, NewEnclosedEnvironment(f.environment), body)
+
+		if raised != nil && s.CatchName != nil {
+			// not accounted for, so an exceeded allocation limit can still be caught
+			environment := NewEnclosedEnvironment(f.environment)
+			environment.Define(s.CatchName.Lexeme, caught(raised))
+
+			c, raised = block(f, environment, catchBody)
+		}
+
+		if finallyBody != nil {
+			f.interpreter.allocateBlock(s.FinallyBody)
+			previous := f.environment
+			f.environment = NewEnclosedEnvironment(previous)
+			finallyCompletion := finallyBody(f)
+			f.environment = previous
+
+			if finallyCompletion != completedNormally {
+				// a return, break or continue in finally discards the exception
+				return finallyCompletion
+			}
+		}
+
+		if raised != nil {
+			panic(raised)
+		}
+
+		return c
+	}
+}
+
+func (i *Interpreter) compileClass(s *stmt.Class) executor {
+	var superclassExpr evaluator
+	if s.Superclass != nil {
+		superclassExpr = i.compileExpr(s.Superclass)
+	}
+
+	bodies := make([]compiledBody, len(s.Methods))
+	for idx, method := range s.Methods {
+		bodies[idx] = i.compileFunctionBody(method.Body)
+	}
+
+	return func(f *frame) completion {
+		var superclass *Class
+		if superclassExpr != nil {
+			maybeClass := superclassExpr(f)
+			var ok bool
+			if superclass, ok = maybeClass.(*Class); !ok {
+				panic(NewRuntimeError(s.Superclass.Name, "Superclass must be a class"))
+			}
+		}
+
+		environment := f.environment
+		if superclass != nil {
+			environment = NewEnclosedEnvironment(environment)
+			environment.Define("super", superclass)
+		}
+
+		methods := map[string]*Function{}
+		for idx, method := range s.Methods {
+			isInitializer := method.Name.Lexeme == "init"
+			methods[method.Name.Lexeme] = newCompiledFunction(method, bodies[idx], environment, isInitializer)
+		}
+
+		class := NewClass(s.Name.Lexeme, superclass, methods)
+		for _, method := range methods {
+			method.class = class
+		}
+		// defined once complete, methods only look the class up when called
+		f.environment.Define(s.Name.Lexeme, class)
+
+		return completedNormally
+	}
+}
+
+// compileExpr counts a step before the expression is evaluated if there is a step limit, like
+// evaluate. The other limits are checked often enough by counting the statements only.
+func (i *Interpreter) compileExpr(expression expr.Expr) evaluator {
+	if i.limits == nil || i.limits.MaxSteps == 0 {
+		return i.compileExprNode(expression)
+	}
+
+	return i.compileCountedExpr(expression)
+}
+
+// compileCountedExpr counts a step before the expression is evaluated if there are limits. Loop
+// conditions are always counted, the body of a loop may have no statement to count.
+func (i *Interpreter) compileCountedExpr(expression expr.Expr) evaluator {
+	evaluate := i.compileExprNode(expression)
+	if i.limits == nil {
+		return evaluate
+	}
+
+	return func(f *frame) interface{} {
+		f.interpreter.step(expression)
+		return evaluate(f)
+	}
+}
+
+func (i *Interpreter) compileExprNode(expression expr.Expr) evaluator {
+	defer i.nest()()
+
+	switch e := expression.(type) {
+	case *expr.Binary:
+		return i.compileBinary(e)
+	case *expr.Logical:
+		left := i.compileExpr(e.Left)
+		right := i.compileExpr(e.Right)
+
+		if e.Operator.Type == token.OR {
+			return func(f *frame) interface{} {
+				if value := left(f); core.IsTruthy(value) {
+					return value
+				}
+				return right(f)
+			}
+		}
+
+		return func(f *frame) interface{} {
+			if value := left(f); !core.IsTruthy(value) {
+				return value
+			}
+			return right(f)
+		}
+	case *expr.Grouping:
+		return i.compileExpr(e.Expression)
+	case *expr.Unary:
+		right := i.compileExpr(e.Right)
+		operator := e.Operator
+
+		if operator.Type == token.MINUS {
+			return func(f *frame) interface{} {
+				value := right(f)
+				if number, ok := value.(float64); ok {
+					return -number
+				}
+				panic(NewRuntimeError(
+					operator,
+					fmt.Sprintf("Operand must be a number, got '%s'", loxTxpe(value)),
+				))
+			}
+		}
+
+		return func(f *frame) interface{} {
+			return !core.IsTruthy(right(f))
+		}
+	case *expr.Literal:
+		value := e.Value
+		return func(f *frame) interface{} { return value }
+	case *expr.Variable:
+		return compileLookUp(e.Name, e.Resolution)
+	case *expr.Assign:
+		return i.compileAssign(e)
+	case *expr.Call:
+		return i.compileCall(e)
+	case *expr.Get:
+		object := i.compileExpr(e.Object)
+		return func(f *frame) interface{} {
+			value := object(f)
+			if o, ok := value.(Object); ok {
+				return o.Get(e.Name)
+			}
+
+			panic(NewRuntimeError(e.Name, fmt.Sprintf("'%s' is not an instance", e.Object)))
+		}
+	case *expr.Set:
+		object := i.compileExpr(e.Object)
+		value := i.compileExpr(e.Value)
+		return func(f *frame) interface{} {
+			o, ok := object(f).(Object)
+			if !ok {
+				panic(NewRuntimeError(e.Name, fmt.Sprintf("'%s' is not an instance", e.Object)))
+			}
+
+			v := value(f)
+			if instance, ok := o.(*Instance); ok && !instance.hasField(e.Name.Lexeme) {
+				f.interpreter.allocate(e.Name, entrySize)
+			}
+			o.Set(e.Name, v)
+
+			return v
+		}
+	case *expr.List:
+		elements := i.compileExprs(e.Elements)
+		return func(f *frame) interface{} {
+			f.interpreter.allocate(e.Bracket, listSize+len(elements)*valueSize)
+			values := make([]interface{}, len(elements))
+			for idx, element := range elements {
+				values[idx] = element(f)
+			}
+
+			return core.NewList(values)
+		}
+	case *expr.Function:
+		declaration := e.Declaration.(*stmt.Function)
+		body := i.compileFunctionBody(declaration.Body)
+		return func(f *frame) interface{} {
+			f.interpreter.allocate(e.Keyword, functionSize)
+			return newCompiledFunction(declaration, body, f.environment, false)
+		}
+	case *expr.Interpolation:
+		parts := i.compileExprs(e.Parts)
+		return func(f *frame) interface{} {
+			stringified := make([]string, len(parts))
+			for idx, part := range parts {
+				stringified[idx] = core.Stringify(part(f))
+			}
+
+			return f.interpreter.join(token.Token{Span: e.Span()}, stringified)
+		}
+	case *expr.Map:
+		keys := i.compileExprs(e.Keys)
+		values := i.compileExprs(e.Values)
+		return func(f *frame) interface{} {
+			f.interpreter.allocate(e.Brace, mapSize+len(keys)*entrySize)
+			m := core.NewMap()
+			for idx, key := range keys {
+				mapSet(e.Brace, m, key(f), values[idx](f))
+			}
+
+			return m
+		}
+	case *expr.Index:
+		object := i.compileExpr(e.Object)
+		index := i.compileExpr(e.Index)
+		return func(f *frame) interface{} {
+			o := object(f)
+			idx := index(f)
+
+			switch o := o.(type) {
+			case *core.List:
+				return o.Elements[checkIndex(e.Bracket, "List", idx, len(o.Elements))]
+			case *core.Map:
+				return mapGet(e.Bracket, o, idx)
+			case string:
+				runes := []rune(o)
+				return string(runes[checkIndex(e.Bracket, "String", idx, len(runes))])
+			}
+
+			panic(NewRuntimeError(e.Bracket, fmt.Sprintf("'%s' is not indexable", loxTxpe(o))))
+		}
+	case *expr.IndexSet:
+		object := i.compileExpr(e.Object)
+		index := i.compileExpr(e.Index)
+		value := i.compileExpr(e.Value)
+		return func(f *frame) interface{} {
+			o := object(f)
+			idx := index(f)
+			v := value(f)
+
+			switch o := o.(type) {
+			case *core.List:
+				o.Elements[checkIndex(e.Bracket, "List", idx, len(o.Elements))] = v
+			case *core.Map:
+				if !mapHas(e.Bracket, o, idx) {
+					f.interpreter.allocate(e.Bracket, entrySize)
+				}
+				mapSet(e.Bracket, o, idx, v)
+			case string:
+				panic(NewRuntimeError(e.Bracket, "Strings are immutable"))
+			default:
+				panic(NewRuntimeError(e.Bracket, fmt.Sprintf("'%s' is not indexable", loxTxpe(o))))
+			}
+
+			return v
+		}
+	case *expr.This:
+		return compileLookUp(e.Keyword, e.Resolution)
+	case *expr.Super:
+		depth, slot := e.Resolution.Depth, e.Resolution.Slot
+		return func(f *frame) interface{} {
+			superclass := f.environment.ReadAt(depth, slot).(*Class)
+			instance := f.environment.ReadAt(depth-1, 0).(*Instance) // 'this' is the only slot
+			method := superclass.findMethod(e.Method.Lexeme)
+
+			if method == nil {
+				panic(NewRuntimeError(e.Method, fmt.Sprintf("Undefined property '%s'", e.Method.Lexeme)))
+			}
+
+			return method.bind(instance)
+		}
+	default:
+		panic(fmt.Sprintf("Unhandled expr %#v", expression))
+	}
+}
+
+func (i *Interpreter) compileExprs(expressions []expr.Expr) []evaluator {
+	evaluators := make([]evaluator, len(expressions))
+	for idx, expression := range expressions {
+		evaluators[idx] = i.compileExpr(expression)
+	}
+
+	return evaluators
+}
+
+// compileBinary picks the closure of the operator, so it isn't switched on when evaluated.
+func (i *Interpreter) compileBinary(e *expr.Binary) evaluator {
+	left := i.compileExpr(e.Left)
+	right := i.compileExpr(e.Right)
+	operator := e.Operator
+
+	switch operator.Type {
+	case token.GREATER:
+		return func(f *frame) interface{} {
+			l, r := numberOperands(operator, left(f), right(f))
+			return l > r
+		}
+	case token.GREATER_EQUAL:
+		return func(f *frame) interface{} {
+			l, r := numberOperands(operator, left(f), right(f))
+			return l >= r
+		}
+	case token.LESS:
+		return func(f *frame) interface{} {
+			l, r := numberOperands(operator, left(f), right(f))
+			return l < r
+		}
+	case token.LESS_EQUAL:
+		return func(f *frame) interface{} {
+			l, r := numberOperands(operator, left(f), right(f))
+			return l <= r
+		}
+	case token.MINUS:
+		return func(f *frame) interface{} {
+			l, r := numberOperands(operator, left(f), right(f))
+			return l - r
+		}
+	case token.PLUS:
+		return func(f *frame) interface{} {
+			l, r := left(f), right(f)
+			switch l := l.(type) {
+			case float64:
+				if r, ok := r.(float64); ok {
+					return l + r
+				}
+			case string:
+				if r, ok := r.(string); ok {
+					f.interpreter.allocate(operator, len(l)+len(r))
+					return l + r
+				}
+			}
+			panic(NewRuntimeError(
+				operator,
+				fmt.Sprintf("Operands must be two numbers or two strings, got '%s' and '%s'", loxTxpe(l), loxTxpe(r)),
+			))
+		}
+	case token.SLASH:
+		return func(f *frame) interface{} {
+			l, r := numberOperands(operator, left(f), right(f))
+			return l / r
+		}
+	case token.STAR:
+		return func(f *frame) interface{} {
+			l, r := numberOperands(operator, left(f), right(f))
+			return l * r
+		}
+	case token.BANG_EQUAL:
+		return func(f *frame) interface{} {
+			return left(f) != right(f)
+		}
+	case token.EQUAL_EQUAL:
+		return func(f *frame) interface{} {
+			return left(f) == right(f)
+		}
+	}
+
+	return func(f *frame) interface{} {
+		left(f)
+		right(f)
+		return nil
+	}
+}
+
+// compileLookUp reads locals of the current and the enclosing environment without walking the
+// chain of environments.
+func compileLookUp(name token.Token, resolution expr.Resolution) evaluator {
+	if !resolution.Local {
+		return func(f *frame) interface{} {
+			return f.interpreter.globals.Read(name)
+		}
+	}
+
+	slot := resolution.Slot
+	switch resolution.Depth {
+	case 0:
+		return func(f *frame) interface{} {
+			return f.environment.slots[slot]
+		}
+	case 1:
+		return func(f *frame) interface{} {
+			return f.environment.enclosing.slots[slot]
+		}
+	}
+
+	depth := resolution.Depth
+	return func(f *frame) interface{} {
+		return f.environment.ReadAt(depth, slot)
+	}
+}
+
+func (i *Interpreter) compileAssign(e *expr.Assign) evaluator {
+	value := i.compileExpr(e.Value)
+
+	if !e.Resolution.Local {
+		return func(f *frame) interface{} {
+			v := value(f)
+			f.interpreter.globals.Assign(e.Name, v)
+			return v
+		}
+	}
+
+	depth, slot := e.Resolution.Depth, e.Resolution.Slot
+	if depth == 0 {
+		return func(f *frame) interface{} {
+			v := value(f)
+			f.environment.slots[slot] = v
+			return v
+		}
+	}
+
+	return func(f *frame) interface{} {
+		v := value(f)
+		f.environment.AssignAt(depth, slot, v)
+		return v
+	}
+}
+
+func (i *Interpreter) compileCall(e *expr.Call) evaluator {
+	callee := i.compileExpr(e.Callee)
+	arguments := i.compileExprs(e.Arguments)
+
+	return func(f *frame) interface{} {
+		calleeValue := callee(f)
+
+		var values []interface{}
+		if len(arguments) > 0 {
+			values = make([]interface{}, len(arguments))
+			for idx, argument := range arguments {
+				values[idx] = argument(f)
+			}
+		}
+
+		function, ok := calleeValue.(Callable)
+		if !ok {
+			panic(NewRuntimeError(e.ClosingParen, fmt.Sprintf("'%s' is not a function", e.Callee)))
+		}
+
+		if len(values) != function.Arity() {
+			panic(NewRuntimeError(
+				e.ClosingParen,
+				fmt.Sprintf("Expected %d arguments but got %d", function.Arity(), len(values)),
+			))
+		}
+
+		return function.Call(f.interpreter, e.ClosingParen, values)
+	}
+}
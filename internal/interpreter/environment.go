@@ -2,13 +2,17 @@ package interpreter
 
 import (
 	"fmt"
+	"sort"
 
 	"github.com/fiurgeist/golox/internal/token"
 )
 
+// Environment holds the values of variables. Global environments look them up by name, local
+// ones by the slot the resolver assigned, which is the order in which they are defined.
 type Environment struct {
 	enclosing           *Environment
-	values              map[string]interface{}
+	values              map[string]interface{} // nil unless global
+	slots               []interface{}
 	functionEnvironment *functionEnvironment
 }
 
@@ -25,21 +29,45 @@ func NewEnvironment() *Environment {
 }
 
 func NewEnclosedEnvironment(enclosing *Environment) *Environment {
-	return &Environment{values: map[string]interface{}{}, enclosing: enclosing}
+	return &Environment{enclosing: enclosing}
 }
 
-func NewFunctionEnvironment(enclosing *Environment) *Environment {
+// NewFunctionEnvironment takes ownership of slots, which hold the parameters.
+func NewFunctionEnvironment(enclosing *Environment, slots []interface{}) *Environment {
 	return &Environment{
-		values:              map[string]interface{}{},
 		enclosing:           enclosing,
+		slots:               slots,
 		functionEnvironment: &functionEnvironment{},
 	}
 }
 
+// Define adds a variable, in a local environment it takes the next slot.
 func (e *Environment) Define(name string, value interface{}) {
+	if e.values == nil {
+		e.slots = append(e.slots, value)
+		return
+	}
+
 	e.values[name] = value
 }
 
+// Names lists the variables defined directly in this environment in alphabetical order.
+func (e *Environment) Names() []string {
+	names := make([]string, 0, len(e.values))
+	for name := range e.values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// Get returns the value of a variable defined directly in this environment.
+func (e *Environment) Get(name string) (interface{}, bool) {
+	value, ok := e.values[name]
+	return value, ok
+}
+
 func (e *Environment) Read(name token.Token) interface{} {
 	value, ok := e.values[name.Lexeme]
 	if ok {
@@ -53,8 +81,8 @@ func (e *Environment) Read(name token.Token) interface{} {
 	panic(NewRuntimeError(name, fmt.Sprintf("Undefined variable '%s'", name.Lexeme)))
 }
 
-func (e *Environment) ReadAt(distance int, name string) interface{} {
-	return e.ancestor(distance).values[name]
+func (e *Environment) ReadAt(distance, slot int) interface{} {
+	return e.ancestor(distance).slots[slot]
 }
 
 func (e *Environment) Assign(name token.Token, value interface{}) {
@@ -71,8 +99,8 @@ func (e *Environment) Assign(name token.Token, value interface{}) {
 	panic(NewRuntimeError(name, fmt.Sprintf("Undefined variable '%s'", name.Lexeme)))
 }
 
-func (e *Environment) AssignAt(distance int, name token.Token, value interface{}) {
-	e.ancestor(distance).values[name.Lexeme] = value
+func (e *Environment) AssignAt(distance, slot int, value interface{}) {
+	e.ancestor(distance).slots[slot] = value
 }
 
 func (e *Environment) StoreReturn(token token.Token, value interface{}) {
@@ -110,6 +138,28 @@ func (e *Environment) ReturnOccurred() bool {
 	return false
 }
 
+// takeReturn removes a pending return value, so it can be restored after running a finally block.
+func (e *Environment) takeReturn() *returnValue {
+	for env := e; env != nil; env = env.enclosing {
+		if env.functionEnvironment != nil {
+			value := env.functionEnvironment.returnValue
+			env.functionEnvironment.returnValue = nil
+			return value
+		}
+	}
+
+	return nil
+}
+
+func (e *Environment) restoreReturn(value *returnValue) {
+	for env := e; env != nil; env = env.enclosing {
+		if env.functionEnvironment != nil {
+			env.functionEnvironment.returnValue = value
+			return
+		}
+	}
+}
+
 func (e *Environment) ancestor(distance int) *Environment {
 	env := e
 	for i := 0; i < distance; i++ {
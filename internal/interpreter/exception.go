@@ -0,0 +1,134 @@
+package interpreter
+
+import (
+	"github.com/fiurgeist/golox/internal/ast/stmt"
+	"github.com/fiurgeist/golox/internal/core"
+	"github.com/fiurgeist/golox/internal/reporter"
+	"github.com/fiurgeist/golox/internal/token"
+)
+
+// Exception is a value raised by a throw statement. Like RuntimeError it unwinds the Go stack via
+// panic until it is recovered by a try statement or by Interpret.
+type Exception struct {
+	Token token.Token
+	Value interface{}
+	Trace []reporter.StackFrame // attached when the exception is first recovered
+}
+
+func NewException(token token.Token, value interface{}) Exception {
+	return Exception{Token: token, Value: value}
+}
+
+// thrown is what a throw statement panics with, a caught runtime error is raised again as it was.
+func thrown(token token.Token, value interface{}) interface{} {
+	if instance, ok := value.(*Instance); ok && instance.err != nil {
+		return *instance.err
+	}
+
+	return NewException(token, value)
+}
+
+// runtimeErrorClass is the class of the error objects runtime errors get converted to when caught.
+var runtimeErrorClass = NewClass(core.ErrorClass, nil, map[string]*Function{})
+
+func (i *Interpreter) executeTry(s *stmt.Try) {
+	raised := i.protect(func() {
+		i.allocateBlock(s.Body)
+		i.executeBlock(s.Body, NewEnclosedEnvironment(i.environment))
+	})
+
+	if raised != nil && s.CatchName != nil {
+		// not accounted for, so an exceeded allocation limit can still be caught
+		environment := NewEnclosedEnvironment(i.environment)
+		environment.Define(s.CatchName.Lexeme, caught(raised))
+
+		raised = i.protect(func() {
+			i.executeBlock(s.CatchBody, environment)
+		})
+	}
+
+	if s.FinallyBody != nil && i.executeFinally(s.FinallyBody) {
+		// a return, break or continue in finally discards the exception
+		return
+	}
+
+	if raised != nil {
+		panic(raised)
+	}
+}
+
+// protect runs fn and returns the Exception or RuntimeError it raised, with the stack trace at the
+// time it was raised. Limit errors can't be caught.
+func (i *Interpreter) protect(fn func()) (raised interface{}) {
+	frames, nesting := len(i.frames), i.nesting
+	defer func() {
+		if p := recover(); p != nil {
+			switch e := p.(type) {
+			case Exception:
+				if e.Trace == nil {
+					e.Trace = i.stackTrace(e.Token.Line)
+				}
+				raised = e
+			case RuntimeError:
+				if e.Trace == nil {
+					e.Trace = i.stackTrace(e.Token.Line)
+				}
+				raised = e
+			default:
+				panic(p) // like a LimitError, keeping the frames for its stack trace
+			}
+
+			i.frames, i.nesting = i.frames[:frames], nesting
+		}
+	}()
+
+	fn()
+
+	return nil
+}
+
+// caught is the value a catch clause binds, runtime errors are converted to error objects.
+func caught(raised interface{}) interface{} {
+	if err, ok := raised.(RuntimeError); ok {
+		return newErrorObject(err)
+	}
+
+	return raised.(Exception).Value
+}
+
+// executeFinally runs the finally block even if a return, break or continue is pending, which is
+// restored afterwards unless the block itself returns, breaks or continues. Reports if it did so.
+func (i *Interpreter) executeFinally(statements []stmt.Stmt) bool {
+	pendingReturn := i.environment.takeReturn()
+	pendingBreak, pendingContinue := i.breakOccurred, i.continueOccurred
+	i.breakOccurred, i.continueOccurred = false, false
+
+	i.allocateBlock(statements)
+	i.executeBlock(statements, NewEnclosedEnvironment(i.environment))
+
+	if i.breakOccurred || i.continueOccurred || i.environment.ReturnOccurred() {
+		return true
+	}
+
+	i.environment.restoreReturn(pendingReturn)
+	i.breakOccurred, i.continueOccurred = pendingBreak, pendingContinue
+
+	return false
+}
+
+func newErrorObject(err RuntimeError) *Instance {
+	return &Instance{
+		class:  runtimeErrorClass,
+		fields: core.ErrorFields(err.Message, err.Token.Line),
+		err:    &err,
+	}
+}
+
+func exceptionMessage(value interface{}) string {
+	var fields map[string]interface{}
+	if instance, ok := value.(*Instance); ok {
+		fields = instance.fields
+	}
+
+	return core.ExceptionMessage(value, fields)
+}
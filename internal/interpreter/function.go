@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/fiurgeist/golox/internal/ast/stmt"
+	"github.com/fiurgeist/golox/internal/token"
 )
 
 var _ Callable = (*Function)(nil)
@@ -11,26 +12,66 @@ var _ Callable = (*Function)(nil)
 type Function struct {
 	declaration   *stmt.Function
 	closure       *Environment
+	globals       *Environment // of the module the function was declared in
+	class         *Class       // nil unless a method
 	isInitializer bool
+	body          executor // nil unless compiled to closures
+	nesting       int      // of the compiled body, counted by evaluate and execute otherwise
 }
 
 func NewFunction(declaration *stmt.Function, closure *Environment, isInitializer bool) *Function {
-	return &Function{declaration: declaration, closure: closure, isInitializer: isInitializer}
+	globals := closure
+	for globals.values == nil { // the first global environment, not the builtins around it
+		globals = globals.enclosing
+	}
+
+	return &Function{declaration: declaration, closure: closure, globals: globals, isInitializer: isInitializer}
+}
+
+func newCompiledFunction(declaration *stmt.Function, body compiledBody, closure *Environment, isInitializer bool) *Function {
+	function := NewFunction(declaration, closure, isInitializer)
+	function.body, function.nesting = body.execute, body.nesting
+
+	return function
 }
 
-func (c *Function) Call(interpreter *Interpreter, arguments []interface{}) interface{} {
-	environment := NewFunctionEnvironment(c.closure)
-	for i, param := range c.declaration.Params {
-		environment.Define(param.Lexeme, arguments[i])
+func (c *Function) Call(interpreter *Interpreter, paren token.Token, arguments []interface{}) interface{} {
+	if interpreter.globals != c.globals {
+		// called from another module
+		previous := interpreter.globals
+		interpreter.globals = c.globals
+		defer func() {
+			interpreter.globals = previous
+		}()
+	}
+
+	interpreter.allocate(paren, environmentSize+len(arguments)*valueSize)
+	// the parameters take the first slots, arguments are owned by the call
+	environment := NewFunctionEnvironment(c.closure, arguments)
+
+	if len(interpreter.frames) >= interpreter.maxCallDepth || interpreter.nesting+c.nesting >= maxNesting {
+		panic(NewRuntimeError(paren, "Stack overflow"))
 	}
 
-	interpreter.executeBlock(c.declaration.Body, environment)
+	interpreter.frames = append(interpreter.frames, callFrame{function: c, line: paren.Line})
+	interpreter.nesting += c.nesting
+	var result interface{}
+	if c.body != nil {
+		f := frame{interpreter: interpreter, environment: environment}
+		c.body(&f)
+		result = f.returnValue
+	} else {
+		interpreter.executeBlock(c.declaration.Body, environment)
+		result = environment.ReadReturn()
+	}
+	interpreter.frames = interpreter.frames[:len(interpreter.frames)-1]
+	interpreter.nesting -= c.nesting
 
 	if c.isInitializer {
-		return c.closure.ReadAt(0, "this")
+		return c.closure.ReadAt(0, 0) // 'this'
 	}
 
-	return environment.ReadReturn()
+	return result
 }
 
 func (c *Function) Arity() int {
@@ -38,11 +79,31 @@ func (c *Function) Arity() int {
 }
 
 func (c *Function) bind(instance *Instance) *Function {
-	environment := NewFunctionEnvironment(c.closure)
-	environment.Define("this", instance)
-	return NewFunction(c.declaration, environment, c.declaration.Name.Lexeme == "init")
+	environment := NewFunctionEnvironment(c.closure, []interface{}{instance}) // 'this'
+	return &Function{
+		declaration:   c.declaration,
+		closure:       environment,
+		globals:       c.globals,
+		class:         c.class,
+		isInitializer: c.declaration.Name.Lexeme == "init",
+		body:          c.body,
+		nesting:       c.nesting,
+	}
+}
+
+func (c *Function) name() string {
+	if c.declaration.Name.Type != token.IDENTIFIER {
+		return "anonymous"
+	}
+
+	return c.declaration.Name.Lexeme
 }
 
 func (c *Function) String() string {
+	if c.declaration.Name.Type != token.IDENTIFIER {
+		// lambdas are named after their "fun" or "=>" token
+		return fmt.Sprintf("<fn anonymous@line %d>", c.declaration.Name.Line)
+	}
+
 	return fmt.Sprintf("<fn %s>", c.declaration.Name.Lexeme)
 }
@@ -3,10 +3,15 @@ package interpreter
 import (
 	"errors"
 	"fmt"
+	"io"
+	"os"
+	"strconv"
 
 	"github.com/fiurgeist/golox/internal/ast/expr"
 	"github.com/fiurgeist/golox/internal/ast/stmt"
+	"github.com/fiurgeist/golox/internal/core"
 	"github.com/fiurgeist/golox/internal/reporter"
+	"github.com/fiurgeist/golox/internal/resolver"
 	"github.com/fiurgeist/golox/internal/token"
 )
 
@@ -15,6 +20,7 @@ var ErrRuntime = errors.New("RuntimeError")
 type RuntimeError struct {
 	Token   token.Token
 	Message string
+	Trace   []reporter.StackFrame // attached when the error reaches Interpret
 }
 
 func NewRuntimeError(token token.Token, message string) RuntimeError {
@@ -22,30 +28,104 @@ func NewRuntimeError(token token.Token, message string) RuntimeError {
 }
 
 type Interpreter struct {
-	globals       *Environment
-	environment   *Environment
-	locals        map[expr.Expr]int
-	reporter      reporter.ErrorReporter
-	breakOccurred bool
+	globals          *Environment
+	environment      *Environment
+	reporter         reporter.ErrorReporter
+	breakOccurred    bool
+	continueOccurred bool
+	path             string // of the interpreted file, relative imports are resolved against it
+	modules          *core.Loader
+	frames           []callFrame
+	maxCallDepth     int
+	nesting          int               // of the Go frames evaluating the syntax tree, see maxNesting
+	resolverOptions  []resolver.Option // for imported modules
+	args             []string          // of the script, returned by the args() native
+	output           io.Writer         // of print statements
+	limits           *core.Limits      // nil without any limits
+	compiled         bool              // statements are compiled to closures before running
+
+	compileNesting, compileMaxNesting int // of the function body being compiled
 }
 
-func NewInterpreter(environment *Environment, reporter reporter.ErrorReporter) Interpreter {
-	environment.Define("clock", &Clock{})
+// DefaultMaxCallDepth is the number of nested calls before a stack overflow is reported.
+const DefaultMaxCallDepth = 10000
 
-	return Interpreter{environment: environment, globals: environment, reporter: reporter, locals: map[expr.Expr]int{}}
+// maxNesting bounds the nested statements and expressions being evaluated, including those of the
+// calling functions, so the Go stack can't overflow however deeply the expressions of each call
+// are nested. Evaluating one takes up to about 2KB of the Go stack, which is limited to 1GB on
+// 64-bit platforms and to 250MB on 32-bit ones.
+const maxNesting = strconv.IntSize * 3125
+
+type Option func(*Interpreter)
+
+// WithMaxCallDepth limits the number of nested calls before a stack overflow is reported. Calls
+// nesting too many expressions report it earlier.
+func WithMaxCallDepth(depth int) Option {
+	return func(i *Interpreter) {
+		i.maxCallDepth = depth
+	}
+}
+
+// WithResolverOptions configures the resolution of imported modules.
+func WithResolverOptions(options ...resolver.Option) Option {
+	return func(i *Interpreter) {
+		i.resolverOptions = options
+	}
+}
+
+// WithArgs sets the command line arguments of the script.
+func WithArgs(args []string) Option {
+	return func(i *Interpreter) {
+		i.args = args
+	}
+}
+
+// WithPath sets the path of the interpreted file.
+func WithPath(path string) Option {
+	return func(i *Interpreter) {
+		i.path = path
+	}
+}
+
+// WithOutput redirects print statements, which write to stdout by default.
+func WithOutput(output io.Writer) Option {
+	return func(i *Interpreter) {
+		i.output = output
+	}
+}
+
+// NewInterpreter runs the statements in the global environment, which can be shared by several
+// interpreters like the inputs of the REPL. The natives are defined once around it.
+func NewInterpreter(environment *Environment, reporter reporter.ErrorReporter, options ...Option) Interpreter {
+	if environment.enclosing == nil {
+		environment.enclosing = newBuiltins()
+	}
+
+	interpreter := Interpreter{
+		environment:  environment,
+		globals:      environment,
+		reporter:     reporter,
+		modules:      core.NewLoader(),
+		maxCallDepth: DefaultMaxCallDepth,
+		output:       os.Stdout,
+	}
+
+	for _, option := range options {
+		option(&interpreter)
+	}
+
+	return interpreter
 }
 
 func (i *Interpreter) Interpret(statements []stmt.Stmt) (err error) {
-	defer func() {
-		if p := recover(); p != nil {
-			if re, ok := p.(RuntimeError); ok {
-				i.reporter.RuntimeError(re.Token, re.Message)
-				err = ErrRuntime
-			} else {
-				panic(p)
-			}
-		}
-	}()
+	defer i.recoverRuntimeError(&err, len(i.frames), i.nesting)
+	defer i.startLimits()()
+	defer i.modules.Enter(i.path)()
+
+	if i.compiled {
+		i.run(statements)
+		return err
+	}
 
 	for _, statement := range statements {
 		i.execute(statement)
@@ -54,44 +134,133 @@ func (i *Interpreter) Interpret(statements []stmt.Stmt) (err error) {
 	return err
 }
 
-func (i *Interpreter) Resolve(expression expr.Expr, depth int) {
-	i.locals[expression] = depth
+// Evaluate returns the value of a resolved expression, errors are reported like by Interpret.
+func (i *Interpreter) Evaluate(expression expr.Expr) (value interface{}, err error) {
+	defer i.recoverRuntimeError(&err, len(i.frames), i.nesting)
+	defer i.startLimits()()
+
+	if i.compiled {
+		return i.compileExpr(expression)(&frame{interpreter: i, environment: i.environment}), nil
+	}
+
+	return i.evaluate(expression), nil
+}
+
+// Call calls a function, class or native from Go, errors are reported like by Interpret.
+func (i *Interpreter) Call(callee interface{}, arguments []interface{}) (result interface{}, err error) {
+	defer i.recoverRuntimeError(&err, len(i.frames), i.nesting)
+	defer i.startLimits()()
+
+	var paren token.Token // there is no call expression
+	function, ok := callee.(Callable)
+	if !ok {
+		panic(NewRuntimeError(paren, fmt.Sprintf("'%s' is not a function", core.Stringify(callee))))
+	}
+
+	if len(arguments) != function.Arity() {
+		panic(NewRuntimeError(
+			paren,
+			fmt.Sprintf("Expected %d arguments but got %d", function.Arity(), len(arguments)),
+		))
+	}
+
+	return function.Call(i, paren, arguments), nil
 }
 
+// SetPath changes the path of the interpreted file, which relative imports are resolved against.
+func (i *Interpreter) SetPath(path string) {
+	i.path = path
+}
+
+// recoverRuntimeError reports a runtime error or an uncaught exception that unwound everything
+// since Interpret, Evaluate or Call was entered, with frames and nesting at that time. They are
+// restored, as natives may call back into Lox while a script is running.
+func (i *Interpreter) recoverRuntimeError(err *error, frames, nesting int) {
+	p := recover()
+	if p == nil {
+		return
+	}
+
+	switch e := p.(type) {
+	case RuntimeError:
+		if e.Trace == nil {
+			e.Trace = i.stackTrace(e.Token.Line)
+		}
+		i.reporter.RuntimeError(e.Token, e.Message, e.Trace)
+		*err = ErrRuntime
+	case LimitError:
+		e.Trace = i.stackTrace(e.Token.Line)
+		i.reporter.RuntimeError(e.Token, e.Message, e.Trace)
+		*err = e.Err
+	case Exception:
+		if e.Trace == nil {
+			e.Trace = i.stackTrace(e.Token.Line)
+		}
+		message := fmt.Sprintf("Uncaught exception: %s", exceptionMessage(e.Value))
+		i.reporter.RuntimeError(e.Token, message, e.Trace)
+		*err = ErrRuntime
+	default:
+		i.frames, i.nesting = i.frames[:frames], nesting
+		panic(p)
+	}
+	i.frames, i.nesting = i.frames[:frames], nesting
+}
+
+// execute counts the nesting of the statement, function calls check it.
 func (i *Interpreter) execute(statement stmt.Stmt) {
+	i.nesting++
+	i.executeNode(statement)
+	i.nesting--
+}
+
+func (i *Interpreter) executeNode(statement stmt.Stmt) {
+	if i.limits != nil {
+		i.step(statement)
+	}
+
 	switch s := statement.(type) {
 	case *stmt.Print:
 		value := i.evaluate(s.Expression)
-		fmt.Println(stringify(value))
+		fmt.Fprintln(i.output, core.Stringify(value))
 	case *stmt.Var:
 		var value interface{}
 		if s.Initializer != nil {
 			value = i.evaluate(s.Initializer)
 		}
 
+		i.allocate(s.Name, valueSize)
 		i.environment.Define(s.Name.Lexeme, value)
 	case *stmt.Expression:
 		i.evaluate(s.Expression)
 	case *stmt.Block:
+		i.allocateBlock(s.Statements)
 		environment := NewEnclosedEnvironment(i.environment)
 		i.executeBlock(s.Statements, environment)
 	case *stmt.If:
-		if isTruthy(i.evaluate(s.Condition)) {
+		if core.IsTruthy(i.evaluate(s.Condition)) {
 			i.execute(s.ThenBranch)
 		} else if s.ElseBranch != nil {
 			i.execute(s.ElseBranch)
 		}
 	case *stmt.While:
-		for isTruthy(i.evaluate(s.Condition)) {
+		for core.IsTruthy(i.evaluate(s.Condition)) {
 			i.execute(s.Body)
 			if i.breakOccurred || i.environment.ReturnOccurred() {
 				i.breakOccurred = false
 				break
 			}
+
+			i.continueOccurred = false
+			if s.Increment != nil {
+				i.evaluate(s.Increment)
+			}
 		}
 	case *stmt.Break:
 		i.breakOccurred = true
+	case *stmt.Continue:
+		i.continueOccurred = true
 	case *stmt.Function:
+		i.allocate(s.Name, valueSize+functionSize)
 		i.environment.Define(s.Name.Lexeme, NewFunction(s, i.environment, false))
 	case *stmt.Return:
 		var value interface{}
@@ -99,9 +268,13 @@ func (i *Interpreter) execute(statement stmt.Stmt) {
 			value = i.evaluate(s.Value)
 		}
 		i.environment.StoreReturn(s.Keyword, value)
+	case *stmt.Import:
+		i.environment.Define(s.Name.Lexeme, i.importModule(s))
+	case *stmt.Throw:
+		panic(thrown(s.Keyword, i.evaluate(s.Value)))
+	case *stmt.Try:
+		i.executeTry(s)
 	case *stmt.Class:
-		i.environment.Define(s.Name.Lexeme, nil)
-
 		var superclass *Class
 		if s.Superclass != nil {
 			maybeClass := i.evaluate(s.Superclass)
@@ -111,8 +284,6 @@ func (i *Interpreter) execute(statement stmt.Stmt) {
 			}
 		}
 
-		i.environment.Define(s.Name.Lexeme, nil)
-
 		if superclass != nil {
 			i.environment = NewEnclosedEnvironment(i.environment)
 			i.environment.Define("super", superclass)
@@ -128,7 +299,11 @@ func (i *Interpreter) execute(statement stmt.Stmt) {
 		}
 
 		class := NewClass(s.Name.Lexeme, superclass, methods)
-		i.environment.Assign(s.Name, class)
+		for _, method := range methods {
+			method.class = class
+		}
+		// defined once complete, methods only look the class up when called
+		i.environment.Define(s.Name.Lexeme, class)
 	default:
 		panic(fmt.Sprintf("Unhandled statement %#v", statement))
 	}
@@ -144,13 +319,26 @@ func (i *Interpreter) executeBlock(statements []stmt.Stmt, environment *Environm
 
 	for _, statement := range statements {
 		i.execute(statement)
-		if i.breakOccurred || i.environment.ReturnOccurred() {
+		if i.breakOccurred || i.continueOccurred || i.environment.ReturnOccurred() {
 			break
 		}
 	}
 }
 
+// evaluate counts the nesting of the expression, function calls check it.
 func (i *Interpreter) evaluate(expression expr.Expr) interface{} {
+	i.nesting++
+	value := i.evaluateNode(expression)
+	i.nesting--
+
+	return value
+}
+
+func (i *Interpreter) evaluateNode(expression expr.Expr) interface{} {
+	if i.limits != nil {
+		i.step(expression)
+	}
+
 	switch e := expression.(type) {
 	case *expr.Binary:
 		left := i.evaluate(e.Left)
@@ -180,6 +368,7 @@ func (i *Interpreter) evaluate(expression expr.Expr) interface{} {
 				}
 			case string:
 				if sRight, ok := right.(string); ok {
+					i.allocate(e.Operator, len(left.(string))+len(sRight))
 					return left.(string) + sRight
 				}
 			}
@@ -204,11 +393,11 @@ func (i *Interpreter) evaluate(expression expr.Expr) interface{} {
 		left := i.evaluate(e.Left)
 
 		if e.Operator.Type == token.OR {
-			if isTruthy(left) {
+			if core.IsTruthy(left) {
 				return left
 			}
 		} else {
-			if !isTruthy(left) {
+			if !core.IsTruthy(left) {
 				return left
 			}
 		}
@@ -229,18 +418,18 @@ func (i *Interpreter) evaluate(expression expr.Expr) interface{} {
 				fmt.Sprintf("Operand must be a number, got '%s'", loxTxpe(right)),
 			))
 		case token.BANG:
-			return !isTruthy(right)
+			return !core.IsTruthy(right)
 		}
 
 		return nil
 	case *expr.Literal:
 		return e.Value
 	case *expr.Variable:
-		return i.lookUpVariable(e.Name, e)
+		return i.lookUpVariable(e.Name, e.Resolution)
 	case *expr.Assign:
 		value := i.evaluate(e.Value)
-		if distance, ok := i.locals[expression]; ok {
-			i.environment.AssignAt(distance, e.Name, value)
+		if e.Resolution.Local {
+			i.environment.AssignAt(e.Resolution.Depth, e.Resolution.Slot, value)
 		} else {
 			i.globals.Assign(e.Name, value)
 		}
@@ -266,32 +455,95 @@ func (i *Interpreter) evaluate(expression expr.Expr) interface{} {
 			))
 		}
 
-		return function.Call(i, arguments)
+		return function.Call(i, e.ClosingParen, arguments)
 	case *expr.Get:
 		object := i.evaluate(e.Object)
-		if i, ok := object.(*Instance); ok {
-			return i.Get(e.Name)
+		if o, ok := object.(Object); ok {
+			return o.Get(e.Name)
 		}
 
 		panic(NewRuntimeError(e.Name, fmt.Sprintf("'%s' is not an instance", e.Object)))
 	case *expr.Set:
 		object := i.evaluate(e.Object)
 
-		inst, ok := object.(*Instance)
+		o, ok := object.(Object)
 		if !ok {
 			panic(NewRuntimeError(e.Name, fmt.Sprintf("'%s' is not an instance", e.Object)))
 		}
 
 		value := i.evaluate(e.Value)
-		inst.Set(e.Name, value)
+		if instance, ok := o.(*Instance); ok && !instance.hasField(e.Name.Lexeme) {
+			i.allocate(e.Name, entrySize)
+		}
+		o.Set(e.Name, value)
+
+		return value
+	case *expr.List:
+		i.allocate(e.Bracket, listSize+len(e.Elements)*valueSize)
+		elements := make([]interface{}, len(e.Elements))
+		for idx, element := range e.Elements {
+			elements[idx] = i.evaluate(element)
+		}
+
+		return core.NewList(elements)
+	case *expr.Function:
+		i.allocate(e.Keyword, functionSize)
+		return NewFunction(e.Declaration.(*stmt.Function), i.environment, false)
+	case *expr.Interpolation:
+		parts := make([]string, len(e.Parts))
+		for idx, part := range e.Parts {
+			parts[idx] = core.Stringify(i.evaluate(part))
+		}
+
+		return i.join(token.Token{Span: e.Span()}, parts)
+	case *expr.Map:
+		i.allocate(e.Brace, mapSize+len(e.Keys)*entrySize)
+		m := core.NewMap()
+		for idx, key := range e.Keys {
+			mapSet(e.Brace, m, i.evaluate(key), i.evaluate(e.Values[idx]))
+		}
+
+		return m
+	case *expr.Index:
+		object := i.evaluate(e.Object)
+		index := i.evaluate(e.Index)
+
+		switch o := object.(type) {
+		case *core.List:
+			return o.Elements[checkIndex(e.Bracket, "List", index, len(o.Elements))]
+		case *core.Map:
+			return mapGet(e.Bracket, o, index)
+		case string:
+			runes := []rune(o)
+			return string(runes[checkIndex(e.Bracket, "String", index, len(runes))])
+		}
+
+		panic(NewRuntimeError(e.Bracket, fmt.Sprintf("'%s' is not indexable", loxTxpe(object))))
+	case *expr.IndexSet:
+		object := i.evaluate(e.Object)
+		index := i.evaluate(e.Index)
+		value := i.evaluate(e.Value)
+
+		switch o := object.(type) {
+		case *core.List:
+			o.Elements[checkIndex(e.Bracket, "List", index, len(o.Elements))] = value
+		case *core.Map:
+			if !mapHas(e.Bracket, o, index) {
+				i.allocate(e.Bracket, entrySize)
+			}
+			mapSet(e.Bracket, o, index, value)
+		case string:
+			panic(NewRuntimeError(e.Bracket, "Strings are immutable"))
+		default:
+			panic(NewRuntimeError(e.Bracket, fmt.Sprintf("'%s' is not indexable", loxTxpe(object))))
+		}
 
 		return value
 	case *expr.This:
-		return i.lookUpVariable(e.Keyword, e)
+		return i.lookUpVariable(e.Keyword, e.Resolution)
 	case *expr.Super:
-		distance := i.locals[expression]
-		superclass := i.environment.ReadAt(distance, "super").(*Class)
-		instance := i.environment.ReadAt(distance-1, "this").(*Instance)
+		superclass := i.environment.ReadAt(e.Resolution.Depth, e.Resolution.Slot).(*Class)
+		instance := i.environment.ReadAt(e.Resolution.Depth-1, 0).(*Instance) // 'this' is the only slot
 		method := superclass.findMethod(e.Method.Lexeme)
 
 		if method == nil {
@@ -304,25 +556,13 @@ func (i *Interpreter) evaluate(expression expr.Expr) interface{} {
 	}
 }
 
-func (i *Interpreter) lookUpVariable(name token.Token, expression expr.Expr) interface{} {
-	if distance, ok := i.locals[expression]; ok {
-		return i.environment.ReadAt(distance, name.Lexeme)
+func (i *Interpreter) lookUpVariable(name token.Token, resolution expr.Resolution) interface{} {
+	if resolution.Local {
+		return i.environment.ReadAt(resolution.Depth, resolution.Slot)
 	}
 	return i.globals.Read(name)
 }
 
-func isTruthy(value interface{}) bool {
-	if value == nil {
-		return false
-	}
-
-	if b, ok := value.(bool); ok {
-		return b
-	}
-
-	return true
-}
-
 func numberOperands(operand token.Token, left, right interface{}) (float64, float64) {
 	l, okL := left.(float64)
 	r, okR := right.(float64)
@@ -337,15 +577,48 @@ func numberOperands(operand token.Token, left, right interface{}) (float64, floa
 	))
 }
 
-func stringify(value interface{}) string {
-	if value == nil {
-		return "nil"
+// Stringify converts a value to a string the same way print does.
+func Stringify(value interface{}) string {
+	return core.Stringify(value)
+}
+
+// checkIndex raises the error of core.CheckIndex at tok.
+func checkIndex(tok token.Token, kind string, index interface{}, length int) int {
+	i, err := core.CheckIndex(kind, index, length, loxTxpe)
+	if err != nil {
+		panic(NewRuntimeError(tok, err.Error()))
+	}
+
+	return i
+}
+
+// checkHashable raises the error of core.CheckHashable at tok.
+func checkHashable(tok token.Token, key interface{}) {
+	if err := core.CheckHashable(key, loxTxpe); err != nil {
+		panic(NewRuntimeError(tok, err.Error()))
 	}
-	if c, ok := value.(interface{ String() string }); ok {
-		return c.String()
+}
+
+// mapGet, mapSet and mapHas raise errors for unhashable and undefined keys at tok.
+func mapGet(tok token.Token, m *core.Map, key interface{}) interface{} {
+	checkHashable(tok, key)
+
+	value, err := m.Get(key)
+	if err != nil {
+		panic(NewRuntimeError(tok, err.Error()))
 	}
 
-	return fmt.Sprintf("%v", value)
+	return value
+}
+
+func mapSet(tok token.Token, m *core.Map, key interface{}, value interface{}) {
+	checkHashable(tok, key)
+	m.Set(key, value)
+}
+
+func mapHas(tok token.Token, m *core.Map, key interface{}) bool {
+	checkHashable(tok, key)
+	return m.Has(key)
 }
 
 func loxTxpe(value interface{}) string {
@@ -360,6 +633,18 @@ func loxTxpe(value interface{}) string {
 		return "string"
 	case bool:
 		return "Boolean"
+	case *core.List:
+		return "list"
+	case *core.Map:
+		return "map"
+	case *Instance, *GoObject:
+		return "instance"
+	case *Class:
+		return "class"
+	case *Module:
+		return "module"
+	case Callable:
+		return "function"
 	default:
 		panic(fmt.Sprintf("Unhandled type '%T'", value))
 	}
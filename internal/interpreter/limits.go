@@ -0,0 +1,76 @@
+package interpreter
+
+import (
+	"context"
+	"time"
+
+	"github.com/fiurgeist/golox/internal/core"
+	"github.com/fiurgeist/golox/internal/token"
+)
+
+var (
+	ErrStepLimit = core.ErrStepLimit
+	ErrTimeout   = core.ErrTimeout
+	ErrCancelled = core.ErrCancelled
+)
+
+// LimitError stops the execution when a limit is exceeded. Unlike a RuntimeError it can't be
+// caught, so untrusted code can't keep running.
+type LimitError struct {
+	RuntimeError
+	Err error // ErrStepLimit, ErrTimeout or ErrCancelled
+}
+
+// WithMaxSteps limits the number of executed statements and evaluated expressions.
+func WithMaxSteps(steps int) Option {
+	return func(i *Interpreter) {
+		i.limit().MaxSteps = steps
+	}
+}
+
+// WithTimeout limits the wall-clock time the execution may take.
+func WithTimeout(timeout time.Duration) Option {
+	return func(i *Interpreter) {
+		i.limit().Timeout = timeout
+	}
+}
+
+// WithContext stops the execution when the context is cancelled or its deadline passes.
+func WithContext(ctx context.Context) Option {
+	return func(i *Interpreter) {
+		i.limit().Ctx = ctx
+	}
+}
+
+func (i *Interpreter) limit() *core.Limits {
+	if i.limits == nil {
+		i.limits = &core.Limits{}
+	}
+
+	return i.limits
+}
+
+// startLimits starts an execution of Interpret, Evaluate or Call, the returned function ends it.
+func (i *Interpreter) startLimits() (stop func()) {
+	if i.limits == nil {
+		return func() {}
+	}
+
+	return i.limits.Start()
+}
+
+// step counts a step of the node, a step is the execution of a statement or the evaluation of an
+// expression. It panics with a LimitError if a limit is exceeded.
+func (i *Interpreter) step(node interface{ Span() token.Span }) {
+	exceeded := i.limits.Step()
+	if exceeded == nil {
+		return
+	}
+
+	span := node.Span()
+	if span.Source == nil {
+		return // like an empty block, the error is raised at the next node with a location
+	}
+
+	panic(LimitError{RuntimeError: NewRuntimeError(token.Token{Span: span}, exceeded.Message), Err: exceeded.Err})
+}
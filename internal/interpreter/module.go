@@ -0,0 +1,94 @@
+package interpreter
+
+import (
+	"fmt"
+
+	"github.com/fiurgeist/golox/internal/ast/stmt"
+	"github.com/fiurgeist/golox/internal/lexer"
+	"github.com/fiurgeist/golox/internal/parser"
+	"github.com/fiurgeist/golox/internal/resolver"
+	"github.com/fiurgeist/golox/internal/token"
+)
+
+var _ Object = (*Module)(nil)
+
+// Module is the namespace object of an imported file exposing its global variables.
+type Module struct {
+	path    string
+	globals *Environment
+}
+
+func (m *Module) Get(name token.Token) interface{} {
+	if value, ok := m.globals.values[name.Lexeme]; ok {
+		return value
+	}
+
+	panic(NewRuntimeError(name, fmt.Sprintf("Undefined property '%s' in module '%s'", name.Lexeme, m.path)))
+}
+
+func (m *Module) Set(name token.Token, value interface{}) {
+	panic(NewRuntimeError(name, fmt.Sprintf("Can't assign to property '%s' of module '%s'", name.Lexeme, m.path)))
+}
+
+func (m *Module) Properties() []string {
+	return m.globals.Names()
+}
+
+func (m *Module) String() string {
+	return fmt.Sprintf("<module %s>", m.path)
+}
+
+func (i *Interpreter) importModule(s *stmt.Import) *Module {
+	module, err := i.modules.Load(i.path, s.Path.Literal.(string), func(path string, source *token.Source) (interface{}, error) {
+		module, err := i.runModule(path, source)
+		if err != nil {
+			return nil, err
+		}
+		return module, nil
+	})
+	if err != nil {
+		panic(NewRuntimeError(s.Path, err.Error()))
+	}
+
+	return module.(*Module)
+}
+
+// runModule executes the file at path in its own interpreter, runtime errors propagate to the
+// importing file, which reports them.
+func (i *Interpreter) runModule(path string, source *token.Source) (*Module, error) {
+	lexer := lexer.NewLexer(source, i.reporter)
+	tokens, errLex := lexer.ScanTokens()
+
+	parser := parser.NewParser(tokens, i.reporter)
+	statements, errParse := parser.Parse()
+
+	if errLex != nil || errParse != nil {
+		return nil, fmt.Errorf("Failed to import '%s'", source.Path)
+	}
+
+	environment := NewEnvironment()
+	interpreter := NewInterpreter(environment, i.reporter, WithPath(path))
+	interpreter.modules = i.modules
+	interpreter.maxCallDepth = i.maxCallDepth
+	interpreter.nesting = i.nesting
+	interpreter.resolverOptions = i.resolverOptions
+	interpreter.args = i.args
+	interpreter.output = i.output
+	interpreter.limits = i.limits
+	interpreter.compiled = i.compiled
+
+	resolver := resolver.NewResolver(i.reporter, i.resolverOptions...)
+	if err := resolver.Resolve(statements); err != nil {
+		return nil, fmt.Errorf("Failed to import '%s'", source.Path)
+	}
+
+	if interpreter.compiled {
+		interpreter.run(statements)
+	} else {
+		for _, statement := range statements {
+			interpreter.execute(statement)
+		}
+	}
+
+	return &Module{path: source.Path, globals: environment}, nil
+}
@@ -1,14 +1,41 @@
 package interpreter
 
 import (
+	"fmt"
 	"time"
+	"unicode/utf8"
+
+	"github.com/fiurgeist/golox/internal/core"
+	"github.com/fiurgeist/golox/internal/token"
 )
 
+// newBuiltins holds the natives around the global environment, so globals can shadow them and
+// they aren't members of a module.
+func newBuiltins() *Environment {
+	builtins := NewEnvironment()
+	builtins.Define("clock", &Clock{})
+	builtins.Define("len", &Len{})
+	builtins.Define("push", &Push{})
+	builtins.Define("pop", &Pop{})
+	builtins.Define("keys", &Keys{})
+	builtins.Define("values", &Values{})
+	builtins.Define("has", &Has{})
+	builtins.Define("remove", &Remove{})
+	builtins.Define("args", &Args{})
+
+	return builtins
+}
+
+// NativeNames lists the names of the natives in alphabetical order.
+func NativeNames() []string {
+	return newBuiltins().Names()
+}
+
 var _ Callable = (*Clock)(nil)
 
 type Clock struct{}
 
-func (c *Clock) Call(interpreter *Interpreter, arguments []interface{}) interface{} {
+func (c *Clock) Call(interpreter *Interpreter, paren token.Token, arguments []interface{}) interface{} {
 	return float64(time.Now().UnixMilli())
 }
 
@@ -19,3 +46,180 @@ func (c *Clock) Arity() int {
 func (c *Clock) String() string {
 	return "<native fn>"
 }
+
+var _ Callable = (*Len)(nil)
+
+type Len struct{}
+
+func (c *Len) Call(interpreter *Interpreter, paren token.Token, arguments []interface{}) interface{} {
+	switch value := arguments[0].(type) {
+	case *core.List:
+		return float64(len(value.Elements))
+	case *core.Map:
+		return float64(value.Len())
+	case string:
+		return float64(utf8.RuneCountInString(value))
+	}
+
+	panic(NewRuntimeError(paren, fmt.Sprintf("Can't get length of '%s'", loxTxpe(arguments[0]))))
+}
+
+func (c *Len) Arity() int {
+	return 1
+}
+
+func (c *Len) String() string {
+	return "<native fn>"
+}
+
+var _ Callable = (*Push)(nil)
+
+type Push struct{}
+
+func (c *Push) Call(interpreter *Interpreter, paren token.Token, arguments []interface{}) interface{} {
+	list := listArgument(paren, arguments[0])
+	interpreter.allocate(paren, valueSize)
+	list.Elements = append(list.Elements, arguments[1])
+	return nil
+}
+
+func (c *Push) Arity() int {
+	return 2
+}
+
+func (c *Push) String() string {
+	return "<native fn>"
+}
+
+var _ Callable = (*Pop)(nil)
+
+type Pop struct{}
+
+func (c *Pop) Call(interpreter *Interpreter, paren token.Token, arguments []interface{}) interface{} {
+	list := listArgument(paren, arguments[0])
+	if len(list.Elements) == 0 {
+		panic(NewRuntimeError(paren, "Can't pop from an empty list"))
+	}
+
+	last := list.Elements[len(list.Elements)-1]
+	list.Elements = list.Elements[:len(list.Elements)-1]
+	return last
+}
+
+func (c *Pop) Arity() int {
+	return 1
+}
+
+func (c *Pop) String() string {
+	return "<native fn>"
+}
+
+func listArgument(paren token.Token, argument interface{}) *core.List {
+	list, ok := argument.(*core.List)
+	if !ok {
+		panic(NewRuntimeError(paren, fmt.Sprintf("Expected a list, got '%s'", loxTxpe(argument))))
+	}
+
+	return list
+}
+
+var _ Callable = (*Keys)(nil)
+
+type Keys struct{}
+
+func (c *Keys) Call(interpreter *Interpreter, paren token.Token, arguments []interface{}) interface{} {
+	m := mapArgument(paren, arguments[0])
+	interpreter.allocate(paren, listSize+m.Len()*valueSize)
+	return core.NewList(m.Keys())
+}
+
+func (c *Keys) Arity() int {
+	return 1
+}
+
+func (c *Keys) String() string {
+	return "<native fn>"
+}
+
+var _ Callable = (*Values)(nil)
+
+type Values struct{}
+
+func (c *Values) Call(interpreter *Interpreter, paren token.Token, arguments []interface{}) interface{} {
+	m := mapArgument(paren, arguments[0])
+	interpreter.allocate(paren, listSize+m.Len()*valueSize)
+	return core.NewList(m.Values())
+}
+
+func (c *Values) Arity() int {
+	return 1
+}
+
+func (c *Values) String() string {
+	return "<native fn>"
+}
+
+var _ Callable = (*Has)(nil)
+
+type Has struct{}
+
+func (c *Has) Call(interpreter *Interpreter, paren token.Token, arguments []interface{}) interface{} {
+	return mapHas(paren, mapArgument(paren, arguments[0]), arguments[1])
+}
+
+func (c *Has) Arity() int {
+	return 2
+}
+
+func (c *Has) String() string {
+	return "<native fn>"
+}
+
+var _ Callable = (*Remove)(nil)
+
+type Remove struct{}
+
+func (c *Remove) Call(interpreter *Interpreter, paren token.Token, arguments []interface{}) interface{} {
+	m := mapArgument(paren, arguments[0])
+	checkHashable(paren, arguments[1])
+
+	return m.Remove(arguments[1])
+}
+
+func (c *Remove) Arity() int {
+	return 2
+}
+
+func (c *Remove) String() string {
+	return "<native fn>"
+}
+
+func mapArgument(paren token.Token, argument interface{}) *core.Map {
+	m, ok := argument.(*core.Map)
+	if !ok {
+		panic(NewRuntimeError(paren, fmt.Sprintf("Expected a map, got '%s'", loxTxpe(argument))))
+	}
+
+	return m
+}
+
+var _ Callable = (*Args)(nil)
+
+type Args struct{}
+
+func (c *Args) Call(interpreter *Interpreter, paren token.Token, arguments []interface{}) interface{} {
+	elements := make([]interface{}, len(interpreter.args))
+	for i, arg := range interpreter.args {
+		elements[i] = arg
+	}
+
+	return core.NewList(elements)
+}
+
+func (c *Args) Arity() int {
+	return 0
+}
+
+func (c *Args) String() string {
+	return "<native fn>"
+}
@@ -0,0 +1,467 @@
+package interpreter
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+
+	"github.com/fiurgeist/golox/internal/core"
+	"github.com/fiurgeist/golox/internal/token"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+var _ Callable = (*GoFunction)(nil)
+
+// GoFunction calls a Go function from Lox, converting its arguments and result by reflection.
+type GoFunction struct {
+	function reflect.Value
+}
+
+// NewGoFunction accepts functions with a fixed number of parameters, returning nothing, a value,
+// an error or a value and an error. A returned error is raised as runtime error.
+func NewGoFunction(function interface{}) (*GoFunction, error) {
+	value := reflect.ValueOf(function)
+	if value.Kind() != reflect.Func || value.IsNil() {
+		return nil, fmt.Errorf("expected a function, got %T", function)
+	}
+
+	t := value.Type()
+	if t.IsVariadic() {
+		return nil, errors.New("variadic functions aren't supported")
+	}
+	if t.NumOut() > 2 || (t.NumOut() == 2 && t.Out(1) != errorType) {
+		return nil, errors.New("expected a function returning at most a value and an error")
+	}
+
+	return &GoFunction{function: value}, nil
+}
+
+func (c *GoFunction) Call(interpreter *Interpreter, paren token.Token, arguments []interface{}) interface{} {
+	defer RecoverGoPanic(paren)
+
+	t := c.function.Type()
+
+	in := make([]reflect.Value, len(arguments))
+	for i, argument := range arguments {
+		value, err := fromLox(argument, t.In(i))
+		if err != nil {
+			panic(NewRuntimeError(paren, fmt.Sprintf("Argument %d: %s", i+1, err)))
+		}
+		in[i] = value
+	}
+
+	out := c.function.Call(in)
+
+	if len(out) != 0 && t.Out(len(out)-1) == errorType {
+		if err, _ := out[len(out)-1].Interface().(error); err != nil {
+			panic(NewRuntimeError(paren, err.Error()))
+		}
+		out = out[:len(out)-1]
+	}
+
+	if len(out) == 0 {
+		return nil
+	}
+
+	result, err := toLox(out[0])
+	if err != nil {
+		panic(NewRuntimeError(paren, fmt.Sprintf("Result: %s", err)))
+	}
+
+	return result
+}
+
+// RecoverGoPanic must be deferred by natives calling Go code, it raises a panic of the Go code as
+// runtime error at paren instead of letting it crash the host program.
+func RecoverGoPanic(paren token.Token) {
+	p := recover()
+	if p == nil {
+		return
+	}
+
+	switch p.(type) {
+	case RuntimeError, LimitError, Exception:
+		panic(p) // raised by Lox code the Go code called back
+	}
+
+	panic(NewRuntimeError(paren, fmt.Sprintf("Go panic: %v", p)))
+}
+
+func (c *GoFunction) Arity() int {
+	return c.function.Type().NumIn()
+}
+
+func (c *GoFunction) String() string {
+	return "<native fn>"
+}
+
+var _ Object = (*GoObject)(nil)
+
+// GoObject exposes the exported fields and methods of a Go struct as properties.
+type GoObject struct {
+	value reflect.Value // an addressable struct
+}
+
+func (o *GoObject) Get(name token.Token) interface{} {
+	if field, ok := o.field(name); ok {
+		if field.Kind() == reflect.Struct {
+			// shares the nested struct, so changes to its fields reach the Go struct as well
+			return &GoObject{value: field}
+		}
+
+		value, err := toLox(field)
+		if err != nil {
+			panic(NewRuntimeError(name, fmt.Sprintf("Property '%s': %s", name.Lexeme, err)))
+		}
+		return value
+	}
+
+	if method := o.value.Addr().MethodByName(name.Lexeme); method.IsValid() {
+		function, err := NewGoFunction(method.Interface())
+		if err != nil {
+			panic(NewRuntimeError(name, fmt.Sprintf("Method '%s': %s", name.Lexeme, err)))
+		}
+		return function
+	}
+
+	panic(NewRuntimeError(name, fmt.Sprintf("Undefined property '%s'", name.Lexeme)))
+}
+
+func (o *GoObject) Set(name token.Token, value interface{}) {
+	field, ok := o.field(name)
+	if !ok {
+		panic(NewRuntimeError(name, fmt.Sprintf("Can't add property '%s' to a Go struct", name.Lexeme)))
+	}
+
+	converted, err := fromLox(value, field.Type())
+	if err != nil {
+		panic(NewRuntimeError(name, fmt.Sprintf("Property '%s': %s", name.Lexeme, err)))
+	}
+
+	field.Set(converted)
+}
+
+func (o *GoObject) Properties() []string {
+	var properties []string
+
+	t := o.value.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).IsExported() {
+			properties = append(properties, t.Field(i).Name)
+		}
+	}
+
+	pointer := o.value.Addr().Type()
+	for i := 0; i < pointer.NumMethod(); i++ {
+		properties = append(properties, pointer.Method(i).Name)
+	}
+
+	sort.Strings(properties)
+	return properties
+}
+
+// field raises a runtime error if the field is promoted through a nil embedded pointer.
+func (o *GoObject) field(name token.Token) (reflect.Value, bool) {
+	field, ok := o.value.Type().FieldByName(name.Lexeme)
+	if !ok || !field.IsExported() {
+		return reflect.Value{}, false
+	}
+
+	value, err := o.value.FieldByIndexErr(field.Index)
+	if err != nil {
+		panic(NewRuntimeError(name, fmt.Sprintf("Property '%s': %s", name.Lexeme, err)))
+	}
+
+	return value, true
+}
+
+func (o *GoObject) String() string {
+	return fmt.Sprintf("%s instance", o.value.Type().Name())
+}
+
+// ToLox converts a Go value: numbers to float64, slices and arrays to lists, maps to maps,
+// structs and pointers to structs to objects sharing the struct if it's a pointer and
+// functions to natives. Lox values are returned unchanged.
+func ToLox(value interface{}) (interface{}, error) {
+	return converting{}.toLoxInterface(value)
+}
+
+func toLox(value reflect.Value) (interface{}, error) {
+	return converting{}.toLox(value)
+}
+
+var errCyclic = errors.New("cyclic value can't be converted")
+
+// converting holds the lists and maps being converted, of Lox or Go, to detect cycles.
+type converting map[interface{}]bool
+
+// enter marks the list or map as being converted, the returned function ends it.
+func (c converting) enter(key interface{}) (func(), error) {
+	if c[key] {
+		return nil, errCyclic
+	}
+	c[key] = true
+
+	return func() { delete(c, key) }, nil
+}
+
+// goReference identifies a Go slice or map being converted, empty slices can't be cyclic.
+type goReference struct {
+	pointer uintptr
+	len     int
+}
+
+func (c converting) toLoxInterface(value interface{}) (interface{}, error) {
+	switch value.(type) {
+	case nil, float64, string, bool, *core.List, *core.Map, Callable, Object:
+		return value, nil
+	}
+
+	return c.toLox(reflect.ValueOf(value))
+}
+
+func (c converting) toLox(value reflect.Value) (interface{}, error) {
+	switch value.Kind() {
+	case reflect.Invalid:
+		return nil, nil
+	case reflect.Bool:
+		return value.Bool(), nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(value.Uint()), nil
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), nil
+	case reflect.String:
+		return value.String(), nil
+	case reflect.Slice, reflect.Array:
+		if value.Kind() == reflect.Slice && value.Len() > 0 {
+			leave, err := c.enter(goReference{pointer: value.Pointer(), len: value.Len()})
+			if err != nil {
+				return nil, err
+			}
+			defer leave()
+		}
+
+		elements := make([]interface{}, value.Len())
+		for i := range elements {
+			element, err := c.toLox(value.Index(i))
+			if err != nil {
+				return nil, err
+			}
+			elements[i] = element
+		}
+		return core.NewList(elements), nil
+	case reflect.Map:
+		leave, err := c.enter(goReference{pointer: value.Pointer()})
+		if err != nil {
+			return nil, err
+		}
+		defer leave()
+
+		result := core.NewMap()
+		keys := value.MapKeys()
+		// Go maps aren't ordered, sorting the keys keeps the Lox map deterministic
+		sort.Slice(keys, func(a, b int) bool { return lessKey(keys[a], keys[b]) })
+		for _, key := range keys {
+			k, err := c.toLox(key)
+			if err != nil {
+				return nil, err
+			}
+			if core.CheckHashable(k, loxTxpe) != nil {
+				return nil, fmt.Errorf("unhashable map key of type '%s'", loxTxpe(k))
+			}
+
+			v, err := c.toLox(value.MapIndex(key))
+			if err != nil {
+				return nil, err
+			}
+
+			result.Set(k, v)
+		}
+		return result, nil
+	case reflect.Struct:
+		copied := reflect.New(value.Type()).Elem()
+		copied.Set(value)
+		return &GoObject{value: copied}, nil
+	case reflect.Pointer:
+		if value.IsNil() {
+			return nil, nil
+		}
+		if value.Elem().Kind() == reflect.Struct {
+			return &GoObject{value: value.Elem()}, nil
+		}
+		return c.toLox(value.Elem())
+	case reflect.Interface:
+		if value.IsNil() {
+			return nil, nil
+		}
+		return c.toLoxInterface(value.Elem().Interface())
+	case reflect.Func:
+		if value.IsNil() {
+			return nil, nil
+		}
+		return NewGoFunction(value.Interface())
+	}
+
+	return nil, fmt.Errorf("unsupported Go type %s", value.Type())
+}
+
+// FromLox converts a Lox value to the Go type of target, which must be a pointer.
+func FromLox(value interface{}, target interface{}) error {
+	pointer := reflect.ValueOf(target)
+	if pointer.Kind() != reflect.Pointer || pointer.IsNil() {
+		return fmt.Errorf("expected a non-nil pointer, got %T", target)
+	}
+
+	converted, err := fromLox(value, pointer.Type().Elem())
+	if err != nil {
+		return err
+	}
+
+	pointer.Elem().Set(converted)
+	return nil
+}
+
+var emptyInterface = reflect.TypeOf((*interface{})(nil)).Elem()
+
+func fromLox(value interface{}, t reflect.Type) (reflect.Value, error) {
+	return converting{}.fromLox(value, t)
+}
+
+// fromLox converts to an empty interface as bool, float64, string, []interface{},
+// map[interface{}]interface{} or the struct of a Go object, other values stay unchanged.
+func (c converting) fromLox(value interface{}, t reflect.Type) (reflect.Value, error) {
+	if value == nil {
+		switch t.Kind() {
+		case reflect.Interface, reflect.Pointer, reflect.Slice, reflect.Map, reflect.Func:
+			return reflect.Zero(t), nil
+		}
+		return reflect.Value{}, expected(t, value)
+	}
+
+	if object, ok := value.(*GoObject); ok {
+		switch {
+		case object.value.Type().AssignableTo(t):
+			return object.value, nil
+		case object.value.Addr().Type().AssignableTo(t):
+			return object.value.Addr(), nil
+		}
+		return reflect.Value{}, expected(t, value)
+	}
+
+	switch t.Kind() {
+	case reflect.Bool:
+		if b, ok := value.(bool); ok {
+			return reflect.ValueOf(b).Convert(t), nil
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if number, ok := value.(float64); ok {
+			converted := reflect.ValueOf(number).Convert(t)
+			if converted.Convert(reflect.TypeOf(number)).Float() != number {
+				return reflect.Value{}, fmt.Errorf("%s doesn't fit into %s", core.Stringify(number), t)
+			}
+			return converted, nil
+		}
+	case reflect.Float32, reflect.Float64:
+		if number, ok := value.(float64); ok {
+			return reflect.ValueOf(number).Convert(t), nil
+		}
+	case reflect.String:
+		if s, ok := value.(string); ok {
+			return reflect.ValueOf(s).Convert(t), nil
+		}
+	case reflect.Slice, reflect.Array:
+		list, ok := value.(*core.List)
+		if !ok {
+			break
+		}
+		if t.Kind() == reflect.Array && t.Len() != len(list.Elements) {
+			return reflect.Value{}, fmt.Errorf("expected %d elements, got %d", t.Len(), len(list.Elements))
+		}
+		leave, err := c.enter(list)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		defer leave()
+
+		result := reflect.New(t).Elem()
+		if t.Kind() == reflect.Slice {
+			result = reflect.MakeSlice(t, len(list.Elements), len(list.Elements))
+		}
+		for i, element := range list.Elements {
+			converted, err := c.fromLox(element, t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			result.Index(i).Set(converted)
+		}
+		return result, nil
+	case reflect.Map:
+		m, ok := value.(*core.Map)
+		if !ok {
+			break
+		}
+		leave, err := c.enter(m)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		defer leave()
+
+		result := reflect.MakeMapWithSize(t, m.Len())
+		values := m.Values()
+		for idx, key := range m.Keys() {
+			k, err := c.fromLox(key, t.Key())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			v, err := c.fromLox(values[idx], t.Elem())
+			if err != nil {
+				return reflect.Value{}, err
+			}
+			result.SetMapIndex(k, v)
+		}
+		return result, nil
+	case reflect.Interface:
+		if t != emptyInterface {
+			if reflect.TypeOf(value).Implements(t) {
+				return reflect.ValueOf(value), nil
+			}
+			break
+		}
+
+		switch value.(type) {
+		case *core.List:
+			return c.fromLox(value, reflect.TypeOf([]interface{}{}))
+		case *core.Map:
+			return c.fromLox(value, reflect.TypeOf(map[interface{}]interface{}{}))
+		}
+		return reflect.ValueOf(&value).Elem(), nil
+	}
+
+	return reflect.Value{}, expected(t, value)
+}
+
+func lessKey(a, b reflect.Value) bool {
+	switch a.Kind() {
+	case reflect.String:
+		return a.String() < b.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return a.Int() < b.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return a.Uint() < b.Uint()
+	case reflect.Float32, reflect.Float64:
+		return a.Float() < b.Float()
+	case reflect.Bool:
+		return !a.Bool() && b.Bool()
+	}
+
+	return fmt.Sprint(a.Interface()) < fmt.Sprint(b.Interface())
+}
+
+func expected(t reflect.Type, value interface{}) error {
+	return fmt.Errorf("expected Go type %s, got '%s'", t, loxTxpe(value))
+}
@@ -4,6 +4,8 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"strings"
+	"unicode/utf8"
 
 	"github.com/fiurgeist/golox/internal/reporter"
 	"github.com/fiurgeist/golox/internal/token"
@@ -12,26 +14,51 @@ import (
 var ErrLexer = errors.New("LexerError")
 
 type Lexer struct {
-	source   []byte
-	start    int
-	current  int
-	line     int
-	hasError bool
-	tokens   []token.Token
-	reporter reporter.ErrorReporter
+	file           *token.Source
+	source         []byte
+	start          int
+	current        int
+	line           int
+	lineStart      int // offset of the current line
+	counted        int // offset up to which the runes of the current line are counted
+	runes          int // of the current line up to counted
+	startLine      int // of the current token
+	startColumn    int // of the current token
+	hasError       bool
+	tokens         []token.Token
+	reporter       reporter.ErrorReporter
+	interpolations []int // brace depth for each open "${" to find its closing '}'
 }
 
-func NewLexer(source []byte, reporter reporter.ErrorReporter) Lexer {
-	return Lexer{source: source, start: 0, current: 0, line: 1, tokens: []token.Token{}, reporter: reporter}
+func NewLexer(source *token.Source, reporter reporter.ErrorReporter) Lexer {
+	return Lexer{
+		file:     source,
+		source:   source.Code,
+		start:    0,
+		current:  0,
+		line:     1,
+		tokens:   []token.Token{},
+		reporter: reporter,
+	}
 }
 
 func (l *Lexer) ScanTokens() ([]token.Token, error) {
 	for !l.isAtEnd() {
 		l.start = l.current
+		l.startLine = l.line
+		l.startColumn = l.column(l.start)
 		l.scanToken()
 	}
 
-	l.tokens = append(l.tokens, token.NewToken(token.EOF, "", nil, l.line))
+	l.start = l.current
+	l.startLine = l.line
+	l.startColumn = l.column(l.start)
+
+	if len(l.interpolations) != 0 {
+		l.error(l.span(), "Unterminated string interpolation")
+	}
+
+	l.tokens = append(l.tokens, token.NewToken(token.EOF, "", nil, l.span()))
 
 	if l.hasError {
 		return l.tokens, ErrLexer
@@ -52,9 +79,27 @@ func (l *Lexer) scanToken() {
 	case ')':
 		l.addToken(token.RIGHT_PAREN)
 	case '{':
+		if depth := len(l.interpolations); depth != 0 {
+			l.interpolations[depth-1]++
+		}
 		l.addToken(token.LEFT_BRACE)
 	case '}':
+		if depth := len(l.interpolations); depth != 0 {
+			if l.interpolations[depth-1] == 0 {
+				// end of the embedded expression, continue with the rest of the string
+				l.interpolations = l.interpolations[:depth-1]
+				l.string(true)
+				return
+			}
+			l.interpolations[depth-1]--
+		}
 		l.addToken(token.RIGHT_BRACE)
+	case '[':
+		l.addToken(token.LEFT_BRACKET)
+	case ']':
+		l.addToken(token.RIGHT_BRACKET)
+	case ':':
+		l.addToken(token.COLON)
 	case ',':
 		l.addToken(token.COMMA)
 	case '.':
@@ -76,6 +121,8 @@ func (l *Lexer) scanToken() {
 	case '=':
 		if l.match('=') {
 			l.addToken(token.EQUAL_EQUAL)
+		} else if l.match('>') {
+			l.addToken(token.ARROW)
 		} else {
 			l.addToken(token.EQUAL)
 		}
@@ -106,17 +153,16 @@ func (l *Lexer) scanToken() {
 	case '\t':
 		break
 	case '\n':
-		l.line++
+		l.newLine()
 	case '"':
-		l.string()
+		l.string(false)
 	default:
 		if l.isDigit(c) {
 			l.number()
 		} else if l.isAlpha(c) {
 			l.identifier()
 		} else {
-			l.hasError = true
-			l.reporter.LexingError(l.line, fmt.Sprintf("Unexpected character '%s' / b'%b'", string(c), c))
+			l.error(l.span(), fmt.Sprintf("Unexpected character '%s' / b'%b'", string(c), c))
 		}
 	}
 }
@@ -127,25 +173,67 @@ func (l *Lexer) advance() byte {
 	return c
 }
 
+func (l *Lexer) newLine() {
+	l.line++
+	l.lineStart = l.current
+	l.counted, l.runes = l.current, 0
+}
+
+// column counts on from the previous column, so long lines aren't counted over and over.
+func (l *Lexer) column(offset int) int {
+	if offset < l.counted {
+		return utf8.RuneCount(l.source[l.lineStart:offset]) + 1
+	}
+
+	l.runes += utf8.RuneCount(l.source[l.counted:offset])
+	l.counted = offset
+	return l.runes + 1
+}
+
+// span of the current token
+func (l *Lexer) span() token.Span {
+	return token.Span{
+		Source: l.file,
+		Line:   l.startLine,
+		Column: l.startColumn,
+		Offset: l.start,
+		Length: l.current - l.start,
+	}
+}
+
+// spanFrom covers the source from offset on the current line up to the current position.
+func (l *Lexer) spanFrom(offset int) token.Span {
+	return token.Span{
+		Source: l.file,
+		Line:   l.line,
+		Column: l.column(offset),
+		Offset: offset,
+		Length: l.current - offset,
+	}
+}
+
+func (l *Lexer) error(span token.Span, message string) {
+	l.hasError = true
+	l.reporter.LexingError(span, message)
+}
+
 func (l *Lexer) addToken(tokenType token.TokenType) {
 	text := string(l.source[l.start:l.current])
-	l.tokens = append(l.tokens, token.NewToken(tokenType, text, nil, l.line))
+	l.tokens = append(l.tokens, token.NewToken(tokenType, text, nil, l.span()))
 }
 
-func (l *Lexer) addStringToken() {
+func (l *Lexer) addStringToken(tokenType token.TokenType, literal string) {
 	text := string(l.source[l.start:l.current])
-	literal := string(l.source[l.start+1 : l.current-1]) // trim quotes
-	l.tokens = append(l.tokens, token.NewToken(token.STRING, text, literal, l.line))
+	l.tokens = append(l.tokens, token.NewToken(tokenType, text, literal, l.span()))
 }
 
 func (l *Lexer) addNumberToken() {
 	text := string(l.source[l.start:l.current])
 	literal, err := strconv.ParseFloat(text, 64)
 	if err != nil {
-		l.hasError = true
-		l.reporter.LexingError(l.line, fmt.Sprintf("Invalid number '%s'", text))
+		l.error(l.span(), fmt.Sprintf("Invalid number '%s'", text))
 	}
-	l.tokens = append(l.tokens, token.NewToken(token.NUMBER, text, literal, l.line))
+	l.tokens = append(l.tokens, token.NewToken(token.NUMBER, text, literal, l.span()))
 }
 
 func (l *Lexer) match(expected byte) bool {
@@ -175,22 +263,119 @@ func (l *Lexer) nextPeek() byte {
 	return l.source[l.current+1]
 }
 
-func (l *Lexer) string() {
+// string scans a string literal, or with interpolated the rest of it after the '}' of an
+// embedded expression. The parts after a '}' have their own token types, so they can't be
+// mistaken for the start of a string by the parser.
+func (l *Lexer) string(interpolated bool) {
+	var literal strings.Builder
+
 	for l.peek() != '"' && !l.isAtEnd() {
-		if l.peek() == '\n' {
-			l.line++
+		c := l.advance()
+		if c == '\n' {
+			l.newLine()
 		}
-		l.advance()
+
+		if c == '\\' {
+			l.escapeSequence(&literal)
+			continue
+		}
+
+		if c == '$' && l.match('{') {
+			l.interpolations = append(l.interpolations, 0)
+			if interpolated {
+				l.addStringToken(token.INTERPOLATION_MIDDLE, literal.String())
+			} else {
+				l.addStringToken(token.INTERPOLATION, literal.String())
+			}
+			return
+		}
+
+		literal.WriteByte(c)
 	}
 
 	if l.isAtEnd() {
-		l.hasError = true
-		l.reporter.LexingError(l.line, "Unterminated string")
+		l.error(l.span(), "Unterminated string")
 		return
 	}
 
 	l.advance() // the closing "
-	l.addStringToken()
+	if interpolated {
+		l.addStringToken(token.INTERPOLATION_END, literal.String())
+	} else {
+		l.addStringToken(token.STRING, literal.String())
+	}
+}
+
+func (l *Lexer) escapeSequence(literal *strings.Builder) {
+	if l.isAtEnd() {
+		return // reported as unterminated string
+	}
+
+	start := l.current - 1 // the backslash
+
+	c := l.advance()
+	switch c {
+	case 'n':
+		literal.WriteByte('\n')
+	case 't':
+		literal.WriteByte('\t')
+	case 'r':
+		literal.WriteByte('\r')
+	case '0':
+		literal.WriteByte(0)
+	case '"':
+		literal.WriteByte('"')
+	case '$':
+		literal.WriteByte('$')
+	case '\\':
+		literal.WriteByte('\\')
+	case 'u':
+		l.unicodeEscape(literal, start)
+	default:
+		r, size := utf8.DecodeRune(l.source[l.current-1:])
+		l.current += size - 1
+		l.error(l.spanFrom(start), fmt.Sprintf("Invalid escape sequence '\\%c' in string", r))
+		if c == '\n' {
+			l.newLine()
+		}
+	}
+}
+
+// unicodeEscape handles \u{XXXX} with one to six hex digits, after the 'u' was consumed.
+// start is the offset of the backslash.
+func (l *Lexer) unicodeEscape(literal *strings.Builder, start int) {
+	if !l.match('{') {
+		l.error(l.spanFrom(start), "Expect '{' after '\\u' in string")
+		return
+	}
+
+	digitsStart := l.current
+	for l.isHexDigit(l.peek()) {
+		l.advance()
+	}
+	digits := string(l.source[digitsStart:l.current])
+
+	if !l.match('}') {
+		l.error(l.spanFrom(start), fmt.Sprintf("Expect '}' after '\\u{%s' in string", digits))
+		return
+	}
+
+	if len(digits) == 0 || len(digits) > 6 {
+		l.error(l.spanFrom(start), fmt.Sprintf("Expect 1 to 6 hex digits in '\\u{%s}'", digits))
+		return
+	}
+
+	codePoint, _ := strconv.ParseUint(digits, 16, 32)
+	if !utf8.ValidRune(rune(codePoint)) {
+		l.error(l.spanFrom(start), fmt.Sprintf("Invalid unicode code point '\\u{%s}'", digits))
+		return
+	}
+
+	literal.WriteRune(rune(codePoint))
+}
+
+func (l *Lexer) isHexDigit(char byte) bool {
+	return l.isDigit(char) || (char >= 'a' && char <= 'f') || (char >= 'A' && char <= 'F')
 }
 
 func (l *Lexer) isDigit(char byte) bool {
@@ -234,15 +419,13 @@ func (l *Lexer) identifier() {
 
 func (l *Lexer) blockComment() {
 	for !l.isAtEnd() && (l.peek() != '*' || l.nextPeek() != '/') {
-		if l.peek() == '\n' {
-			l.line++
+		if l.advance() == '\n' {
+			l.newLine()
 		}
-		l.advance()
 	}
 
 	if l.isAtEnd() || l.peek() != '*' || l.nextPeek() != '/' {
-		l.hasError = true
-		l.reporter.LexingError(l.line, "Unterminated comment block")
+		l.error(l.span(), "Unterminated comment block")
 		return
 	}
 
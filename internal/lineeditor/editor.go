@@ -0,0 +1,410 @@
+package lineeditor
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	ErrNotTerminal = errors.New("input is not a terminal")
+	ErrInterrupted = errors.New("Interrupted")
+)
+
+const (
+	ctrlA     = 1
+	ctrlB     = 2
+	ctrlC     = 3
+	ctrlD     = 4
+	ctrlE     = 5
+	ctrlF     = 6
+	ctrlG     = 7
+	ctrlH     = 8
+	tab       = 9
+	ctrlK     = 11
+	ctrlL     = 12
+	enter     = 13
+	ctrlN     = 14
+	ctrlP     = 16
+	ctrlR     = 18
+	ctrlU     = 21
+	ctrlW     = 23
+	escape    = 27
+	backspace = 127
+)
+
+// escape sequences are mapped to runes outside of the unicode range
+const (
+	keyUp = utf8.MaxRune + 1 + iota
+	keyDown
+	keyRight
+	keyLeft
+	keyHome
+	keyEnd
+	keyDelete
+	keyUnknown
+)
+
+// Completer returns the candidates for the word ending at the end of head, which is the
+// line up to the cursor, and the byte offset in head where that word starts.
+type Completer func(head string) (start int, candidates []string)
+
+// Editor reads single lines from a terminal with emacs-style key bindings, a history and
+// tab completion. Lines wider than the terminal aren't supported.
+type Editor struct {
+	in       *os.File
+	reader   *bufio.Reader
+	out      io.Writer
+	complete Completer
+	history  *history
+	pending  rune // key to process before reading the next one
+
+	prompt       string
+	line         []rune
+	cursor       int
+	historyIndex int
+	draft        []rune // the new line while browsing the history
+}
+
+// NewEditor fails with ErrNotTerminal if in isn't a terminal. The history is kept in the file
+// at historyPath, it's not persisted if the path is empty.
+func NewEditor(in *os.File, out io.Writer, historyPath string, complete Completer) (*Editor, error) {
+	if !isTerminal(in.Fd()) {
+		return nil, ErrNotTerminal
+	}
+
+	return &Editor{
+		in:       in,
+		reader:   bufio.NewReader(in),
+		out:      out,
+		complete: complete,
+		history:  loadHistory(historyPath),
+	}, nil
+}
+
+// ReadLine returns io.EOF on Ctrl-D in an empty line and ErrInterrupted on Ctrl-C.
+func (e *Editor) ReadLine(prompt string) (string, error) {
+	restore, err := makeRaw(e.in.Fd())
+	if err != nil {
+		return "", err
+	}
+	defer restore()
+
+	e.prompt = prompt
+	e.line = nil
+	e.cursor = 0
+	e.historyIndex = len(e.history.lines)
+	e.draft = nil
+	e.refresh()
+
+	for {
+		key, err := e.readKey()
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case enter, '\n':
+			e.cursor = len(e.line)
+			e.refresh()
+			e.write("\r\n")
+
+			line := string(e.line)
+			e.history.add(line)
+			return line, nil
+		case ctrlC:
+			e.write("^C\r\n")
+			return "", ErrInterrupted
+		case ctrlD:
+			if len(e.line) == 0 {
+				e.write("\r\n")
+				return "", io.EOF
+			}
+			e.deleteForward()
+		case ctrlA, keyHome:
+			e.cursor = 0
+		case ctrlE, keyEnd:
+			e.cursor = len(e.line)
+		case ctrlB, keyLeft:
+			if e.cursor > 0 {
+				e.cursor--
+			}
+		case ctrlF, keyRight:
+			if e.cursor < len(e.line) {
+				e.cursor++
+			}
+		case backspace, ctrlH:
+			if e.cursor > 0 {
+				e.cursor--
+				e.deleteForward()
+			}
+		case keyDelete:
+			e.deleteForward()
+		case ctrlK:
+			e.line = e.line[:e.cursor]
+		case ctrlU:
+			e.line = e.line[e.cursor:]
+			e.cursor = 0
+		case ctrlW:
+			e.deleteWord()
+		case ctrlL:
+			e.write("\x1b[H\x1b[2J")
+		case ctrlP, keyUp:
+			e.previousHistory()
+		case ctrlN, keyDown:
+			e.nextHistory()
+		case ctrlR:
+			if err := e.reverseSearch(); err != nil {
+				return "", err
+			}
+		case tab:
+			e.completeWord()
+		default:
+			if key >= ' ' && key <= utf8.MaxRune {
+				e.insert([]rune{key})
+			}
+		}
+
+		e.refresh()
+	}
+}
+
+func (e *Editor) readKey() (rune, error) {
+	if e.pending != 0 {
+		key := e.pending
+		e.pending = 0
+		return key, nil
+	}
+
+	key, _, err := e.reader.ReadRune()
+	if err != nil || key != escape {
+		return key, err
+	}
+
+	return e.escapeSequence()
+}
+
+// escapeSequence reads the rest of a CSI "ESC [ params final" or SS3 "ESC O final" sequence.
+func (e *Editor) escapeSequence() (rune, error) {
+	kind, _, err := e.reader.ReadRune()
+	if err != nil {
+		return 0, err
+	}
+	if kind != '[' && kind != 'O' {
+		return keyUnknown, nil
+	}
+
+	var params strings.Builder
+	for {
+		c, _, err := e.reader.ReadRune()
+		if err != nil {
+			return 0, err
+		}
+
+		if c >= 0x40 && c <= 0x7e {
+			return escapeKey(params.String(), c), nil
+		}
+		params.WriteRune(c)
+	}
+}
+
+func escapeKey(params string, final rune) rune {
+	switch final {
+	case 'A':
+		return keyUp
+	case 'B':
+		return keyDown
+	case 'C':
+		return keyRight
+	case 'D':
+		return keyLeft
+	case 'H':
+		return keyHome
+	case 'F':
+		return keyEnd
+	case '~':
+		switch params {
+		case "1", "7":
+			return keyHome
+		case "4", "8":
+			return keyEnd
+		case "3":
+			return keyDelete
+		}
+	}
+
+	return keyUnknown
+}
+
+func (e *Editor) write(s string) {
+	io.WriteString(e.out, s)
+}
+
+// refresh redraws the prompt and the line, then moves the cursor into place.
+func (e *Editor) refresh() {
+	var b strings.Builder
+	fmt.Fprintf(&b, "\r%s%s\x1b[K", e.prompt, string(e.line))
+	if back := len(e.line) - e.cursor; back > 0 {
+		fmt.Fprintf(&b, "\x1b[%dD", back)
+	}
+
+	e.write(b.String())
+}
+
+func (e *Editor) insert(runes []rune) {
+	line := make([]rune, 0, len(e.line)+len(runes))
+	line = append(line, e.line[:e.cursor]...)
+	line = append(line, runes...)
+	e.line = append(line, e.line[e.cursor:]...)
+	e.cursor += len(runes)
+}
+
+func (e *Editor) deleteForward() {
+	if e.cursor < len(e.line) {
+		e.line = append(e.line[:e.cursor], e.line[e.cursor+1:]...)
+	}
+}
+
+// deleteWord deletes the word in front of the cursor and the spaces following it.
+func (e *Editor) deleteWord() {
+	start := e.cursor
+	for start > 0 && e.line[start-1] == ' ' {
+		start--
+	}
+	for start > 0 && e.line[start-1] != ' ' {
+		start--
+	}
+
+	e.line = append(e.line[:start], e.line[e.cursor:]...)
+	e.cursor = start
+}
+
+func (e *Editor) previousHistory() {
+	if e.historyIndex == 0 {
+		return
+	}
+
+	if e.historyIndex == len(e.history.lines) {
+		e.draft = e.line
+	}
+	e.historyIndex--
+	e.line = []rune(e.history.lines[e.historyIndex])
+	e.cursor = len(e.line)
+}
+
+func (e *Editor) nextHistory() {
+	if e.historyIndex == len(e.history.lines) {
+		return
+	}
+
+	e.historyIndex++
+	if e.historyIndex == len(e.history.lines) {
+		e.line = e.draft
+	} else {
+		e.line = []rune(e.history.lines[e.historyIndex])
+	}
+	e.cursor = len(e.line)
+}
+
+// reverseSearch finds the latest history line containing the typed query, Ctrl-R moves on to
+// older matches. Any other key takes the match into the line and is processed as usual,
+// Ctrl-G and Ctrl-C cancel the search.
+func (e *Editor) reverseSearch() error {
+	var query []rune
+	index := len(e.history.lines)
+	failed := false
+
+	for {
+		match := ""
+		if index < len(e.history.lines) {
+			match = e.history.lines[index]
+		}
+
+		status := "reverse-i-search"
+		if failed {
+			status = "failed " + status
+		}
+		e.write(fmt.Sprintf("\r(%s)`%s': %s\x1b[K", status, string(query), match))
+
+		key, err := e.readKey()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case key == ctrlR:
+			e.search(string(query), index-1, &index, &failed)
+		case key == backspace || key == ctrlH:
+			if len(query) > 0 {
+				query = query[:len(query)-1]
+			}
+			index = len(e.history.lines)
+			e.search(string(query), index-1, &index, &failed)
+		case key == ctrlG || key == ctrlC:
+			return nil
+		case key >= ' ' && key <= utf8.MaxRune:
+			query = append(query, key)
+			e.search(string(query), min(index, len(e.history.lines)-1), &index, &failed)
+		default:
+			if match != "" {
+				e.line = []rune(match)
+				e.cursor = len(e.line)
+				e.historyIndex = index
+			}
+			e.pending = key
+			return nil
+		}
+	}
+}
+
+// search looks for the query in the history from the line at start backwards, index is only
+// updated on a match.
+func (e *Editor) search(query string, start int, index *int, failed *bool) {
+	if found := e.history.search(query, start); found >= 0 {
+		*index = found
+		*failed = false
+	} else {
+		*failed = true
+	}
+}
+
+// completeWord extends the word in front of the cursor with the common prefix of all candidates,
+// the candidates are listed if that doesn't extend the word.
+func (e *Editor) completeWord() {
+	if e.complete == nil {
+		return
+	}
+
+	head := string(e.line[:e.cursor])
+	start, candidates := e.complete(head)
+	if len(candidates) == 0 {
+		e.write("\a")
+		return
+	}
+
+	word := head[start:]
+	if prefix := commonPrefix(candidates); len(prefix) > len(word) {
+		e.insert([]rune(prefix[len(word):]))
+		return
+	}
+
+	if len(candidates) > 1 {
+		e.write("\r\n" + strings.Join(candidates, "  ") + "\r\n")
+	}
+}
+
+func commonPrefix(words []string) string {
+	prefix := words[0]
+	for _, word := range words[1:] {
+		for !strings.HasPrefix(word, prefix) {
+			_, size := utf8.DecodeLastRuneInString(prefix)
+			prefix = prefix[:len(prefix)-size]
+		}
+	}
+
+	return prefix
+}
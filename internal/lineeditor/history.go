@@ -0,0 +1,78 @@
+package lineeditor
+
+import (
+	"os"
+	"strings"
+)
+
+const maxHistory = 1000
+
+type history struct {
+	path  string // empty if not persisted
+	lines []string
+}
+
+// loadHistory starts without any lines if the file can't be read.
+func loadHistory(path string) *history {
+	h := &history{path: path}
+	if path == "" {
+		return h
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return h
+	}
+
+	for _, line := range strings.Split(string(content), "\n") {
+		if line != "" {
+			h.lines = append(h.lines, line)
+		}
+	}
+	if len(h.lines) > maxHistory {
+		// lines are appended to the file, it's only truncated here
+		h.lines = h.lines[len(h.lines)-maxHistory:]
+		os.WriteFile(path, []byte(strings.Join(h.lines, "\n")+"\n"), 0o600)
+	}
+
+	return h
+}
+
+// add skips blank lines and repetitions of the previous line and drops the oldest line beyond
+// maxHistory. A line that can't be persisted is still available in this session.
+func (h *history) add(line string) {
+	if strings.TrimSpace(line) == "" {
+		return
+	}
+	if len(h.lines) != 0 && h.lines[len(h.lines)-1] == line {
+		return
+	}
+
+	h.lines = append(h.lines, line)
+	if len(h.lines) > maxHistory {
+		h.lines = h.lines[1:]
+	}
+
+	if h.path == "" {
+		return
+	}
+
+	file, err := os.OpenFile(h.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return
+	}
+	defer file.Close()
+
+	file.WriteString(line + "\n")
+}
+
+// search returns the index of the latest line up to start containing the query, -1 if none does.
+func (h *history) search(query string, start int) int {
+	for i := start; i >= 0; i-- {
+		if strings.Contains(h.lines[i], query) {
+			return i
+		}
+	}
+
+	return -1
+}
@@ -0,0 +1,35 @@
+package lineeditor
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestHistoryIsCapped(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+
+	h := loadHistory(path)
+	for i := 0; i < maxHistory+10; i++ {
+		h.add(fmt.Sprintf("print %d;", i))
+	}
+
+	if len(h.lines) != maxHistory || h.lines[0] != "print 10;" {
+		t.Errorf("added: %d lines starting with %q, want %d starting with \"print 10;\"", len(h.lines), h.lines[0], maxHistory)
+	}
+
+	h = loadHistory(path)
+	if len(h.lines) != maxHistory || h.lines[0] != "print 10;" {
+		t.Errorf("loaded: %d lines starting with %q, want %d starting with \"print 10;\"", len(h.lines), h.lines[0], maxHistory)
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(content), "\n"); lines != maxHistory {
+		t.Errorf("the file has %d lines after loading, want %d", lines, maxHistory)
+	}
+}
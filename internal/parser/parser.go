@@ -16,10 +16,12 @@ program        → declaration* EOF ;
 declaration    → varDecl
                | classDecl
                | funDecl
+               | importDecl
                | statement ;
 classDecl      → "class" IDENTIFIER ( "<" IDENTIFIER )? "{" function* "}" ;
 varDecl        → "var" IDENTIFIER ( "=" expression )? ";" ;
 funDecl        → "fun" function ;
+importDecl     → "import" STRING "as" IDENTIFIER ";" ;
 function       → IDENTIFIER "(" parameters? ")" block ;
 parameters     → IDENTIFIER ( "," IDENTIFIER )* ;
 
@@ -29,7 +31,10 @@ statement      → exprStmt
                | whileStmt
                | forStmt
                | breakStmt
+               | continueStmt
                | returnStmt
+               | throwStmt
+               | tryStmt
                | block ;
 
 exprStmt       → expression ";" ;
@@ -41,11 +46,17 @@ forStmt        → "for" "(" ( varDecl | exprStmt | ";" )
                  expression? ";"
                  expression? ")" statement ;
 breakStmt      → "break" ";" ;
+continueStmt   → "continue" ";" ;
 returnStmt     → "return" expression? ";" ;
+throwStmt      → "throw" expression ";" ;
+tryStmt        → "try" block
+                 ( "catch" "(" IDENTIFIER ")" block )?
+                 ( "finally" block )? ;
 block          → "{" declaration* "}" ;
 
 expression     → assignment ;
 assignment     → ( call "." )? IDENTIFIER "=" assignment
+               | call "[" expression "]" "=" assignment
                | logic_or ;
 logic_or       → logic_and ( "or" logic_and )* ;
 logic_and      → equality ( "and" equality )* ;
@@ -54,11 +65,18 @@ comparison     → term ( ( ">" | ">=" | "<" | "<=" ) term )* ;
 term           → factor ( ( "-" | "+" ) factor )* ;
 factor         → unary ( ( "/" | "*" ) unary )* ;
 unary          → ( "!" | "-" ) unary | call ;
-call           → primary ( "(" arguments? ")" | "." IDENTIFIER )* ;
+call           → primary ( "(" arguments? ")" | "." IDENTIFIER | "[" expression "]" )* ;
 arguments      → expression ( "," expression )* ;
+entry          → expression ":" expression ;
 primary        → NUMBER | STRING | "true" | "false" | "nil" | "this"
+               | INTERPOLATION expression ( INTERPOLATION_MIDDLE expression )* INTERPOLATION_END
                | "(" expression ")" | IDENTIFIER
-               | "super" "." IDENTIFIER ;
+               | "[" ( expression ( "," expression )* )? "]"
+               | "{" ( entry ( "," entry )* )? "}"
+               | "super" "." IDENTIFIER
+               | lambda ;
+lambda         → "fun" "(" parameters? ")" block
+               | "(" parameters? ")" "=>" ( block | expression ) ;
 */
 
 var ErrParser = errors.New("ParseError")
@@ -67,6 +85,7 @@ type Parser struct {
 	current  int
 	tokens   []token.Token
 	inLoop   bool
+	hasError bool // for errors the parser recovers from on the spot
 	reporter reporter.ErrorReporter
 }
 
@@ -85,12 +104,35 @@ func (p *Parser) Parse() (statements []stmt.Stmt, anyErr error) {
 		statements = append(statements, declaration)
 	}
 
+	if anyErr == nil && p.hasError {
+		anyErr = ErrParser
+	}
+
 	return statements, anyErr
 }
 
+// ParseExpression parses tokens consisting of a single expression, optionally followed by a ';'.
+func (p *Parser) ParseExpression() (expression expr.Expr, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = ErrParser
+		}
+	}()
+
+	expression = p.expression()
+	p.match(token.SEMICOLON)
+	p.consume(token.EOF, "Expect end of expression")
+
+	if p.hasError {
+		return expression, ErrParser
+	}
+
+	return expression, nil
+}
+
 func (p *Parser) declaration() (statement stmt.Stmt, err error) {
 	defer func() {
-		if err := recover(); err != nil {
+		if r := recover(); r != nil {
 			p.synchronize()
 			err = ErrParser
 		}
@@ -100,7 +142,8 @@ func (p *Parser) declaration() (statement stmt.Stmt, err error) {
 		return p.varDeclaration(), err
 	}
 
-	if p.match(token.FUN) {
+	if p.check(token.FUN) && p.checkNext(token.IDENTIFIER) {
+		p.advance()
 		return p.function("function"), err
 	}
 
@@ -108,6 +151,10 @@ func (p *Parser) declaration() (statement stmt.Stmt, err error) {
 		return p.class(), err
 	}
 
+	if p.match(token.IMPORT) {
+		return p.importDeclaration(), err
+	}
+
 	return p.statement(), err
 }
 
@@ -128,7 +175,16 @@ func (p *Parser) function(kind string) *stmt.Function {
 	name := p.consume(token.IDENTIFIER, fmt.Sprintf("Expect %s name", kind))
 
 	p.consume(token.LEFT_PAREN, fmt.Sprintf("Expect '(' after %s name", kind))
+	params := p.parameters(kind)
 
+	p.consume(token.LEFT_BRACE, fmt.Sprintf("Expect '{' before %s body", kind))
+	body := p.functionBody()
+
+	return stmt.NewFunction(name, params, body)
+}
+
+// parameters parses the parameter list after the opening '(' including the closing ')'.
+func (p *Parser) parameters(kind string) []token.Token {
 	var params []token.Token
 	if !p.check(token.RIGHT_PAREN) {
 		param := p.consume(token.IDENTIFIER, fmt.Sprintf("Expect %s parameter", kind))
@@ -136,7 +192,7 @@ func (p *Parser) function(kind string) *stmt.Function {
 
 		for p.match(token.COMMA) {
 			if len(params) >= 255 {
-				p.reporter.ParseError(p.peek(), "Can't have more than 255 parameters")
+				p.error(p.peek(), "Can't have more than 255 parameters")
 			}
 
 			param := p.consume(token.IDENTIFIER, fmt.Sprintf("Expect %s parameter", kind))
@@ -146,10 +202,18 @@ func (p *Parser) function(kind string) *stmt.Function {
 
 	p.consume(token.RIGHT_PAREN, fmt.Sprintf("Expect ')' after %s parameters", kind))
 
-	p.consume(token.LEFT_BRACE, fmt.Sprintf("Expect '{' before %s body", kind))
-	body := p.block()
+	return params
+}
 
-	return stmt.NewFunction(name, params, body)
+// functionBody parses a block, a loop around the function doesn't allow a break inside of it.
+func (p *Parser) functionBody() []stmt.Stmt {
+	previousInLoop := p.inLoop
+	p.inLoop = false
+	defer func() {
+		p.inLoop = previousInLoop
+	}()
+
+	return p.block()
 }
 
 func (p *Parser) class() stmt.Stmt {
@@ -173,6 +237,16 @@ func (p *Parser) class() stmt.Stmt {
 	return stmt.NewClass(name, superclass, methods)
 }
 
+func (p *Parser) importDeclaration() stmt.Stmt {
+	keyword := p.previous()
+	path := p.consume(token.STRING, "Expect module path after import")
+	p.consume(token.AS, "Expect 'as' after module path")
+	name := p.consume(token.IDENTIFIER, "Expect module name after 'as'")
+	p.consume(token.SEMICOLON, "Expect ';' after import")
+
+	return stmt.NewImport(keyword, path, name)
+}
+
 func (p *Parser) statement() stmt.Stmt {
 	if p.match(token.PRINT) {
 		return p.printStatement()
@@ -194,10 +268,22 @@ func (p *Parser) statement() stmt.Stmt {
 		return p.breakStatement()
 	}
 
+	if p.match(token.CONTINUE) {
+		return p.continueStatement()
+	}
+
 	if p.match(token.RETURN) {
 		return p.returnStatement()
 	}
 
+	if p.match(token.THROW) {
+		return p.throwStatement()
+	}
+
+	if p.match(token.TRY) {
+		return p.tryStatement()
+	}
+
 	if p.match(token.LEFT_BRACE) {
 		return stmt.NewBlock(p.block())
 	}
@@ -206,12 +292,14 @@ func (p *Parser) statement() stmt.Stmt {
 }
 
 func (p *Parser) printStatement() stmt.Stmt {
+	keyword := p.previous()
 	value := p.expression()
 	p.consume(token.SEMICOLON, "Expect ';' after value")
-	return stmt.NewPrint(value)
+	return stmt.NewPrint(keyword, value)
 }
 
 func (p *Parser) ifStatement() stmt.Stmt {
+	keyword := p.previous()
 	p.consume(token.LEFT_PAREN, "Expect '(' after if")
 	condition := p.expression()
 	p.consume(token.RIGHT_PAREN, "Expect ')' after if condition")
@@ -223,10 +311,11 @@ func (p *Parser) ifStatement() stmt.Stmt {
 		elseBranch = p.statement()
 	}
 
-	return stmt.NewIf(condition, thenBranch, elseBranch)
+	return stmt.NewIf(keyword, condition, thenBranch, elseBranch)
 }
 
 func (p *Parser) whileStatement() stmt.Stmt {
+	keyword := p.previous()
 	previousInLoop := p.inLoop
 	p.inLoop = true
 	defer func() {
@@ -238,10 +327,11 @@ func (p *Parser) whileStatement() stmt.Stmt {
 	p.consume(token.RIGHT_PAREN, "Expect ')' after while condition")
 
 	body := p.statement()
-	return stmt.NewWhile(condition, body)
+	return stmt.NewWhile(keyword, condition, body, nil)
 }
 
 func (p *Parser) forStatement() stmt.Stmt {
+	keyword := p.previous()
 	previousInLoop := p.inLoop
 	p.inLoop = true
 	defer func() {
@@ -273,15 +363,13 @@ func (p *Parser) forStatement() stmt.Stmt {
 	p.consume(token.RIGHT_PAREN, "Expect ')' after for condition")
 
 	body := p.statement()
-	if increment != nil {
-		body = stmt.NewBlock([]stmt.Stmt{body, stmt.NewExpression(increment)})
-	}
 
 	if condition == nil {
-		condition = expr.NewLiteral(true)
+		condition = expr.NewLiteral(true, keyword)
 	}
 
-	var desugaredFor stmt.Stmt = stmt.NewWhile(condition, body)
+	// the increment isn't appended to the body, it has to run after a continue as well
+	var desugaredFor stmt.Stmt = stmt.NewWhile(keyword, condition, body, increment)
 	if initializer != nil {
 		desugaredFor = stmt.NewBlock([]stmt.Stmt{initializer, desugaredFor})
 	}
@@ -291,11 +379,20 @@ func (p *Parser) forStatement() stmt.Stmt {
 
 func (p *Parser) breakStatement() stmt.Stmt {
 	if !p.inLoop {
-		p.reporter.ParseError(p.previous(), "Outside of a loop")
+		p.error(p.previous(), "Outside of a loop")
 	}
 
 	p.consume(token.SEMICOLON, "Expect ';' after break")
-	return stmt.NewBreak()
+	return stmt.NewBreak(p.previous())
+}
+
+func (p *Parser) continueStatement() stmt.Stmt {
+	if !p.inLoop {
+		p.error(p.previous(), "Outside of a loop")
+	}
+
+	p.consume(token.SEMICOLON, "Expect ';' after continue")
+	return stmt.NewContinue(p.previous())
 }
 
 func (p *Parser) returnStatement() stmt.Stmt {
@@ -310,12 +407,53 @@ func (p *Parser) returnStatement() stmt.Stmt {
 	return stmt.NewReturn(keyword, value)
 }
 
+func (p *Parser) throwStatement() stmt.Stmt {
+	keyword := p.previous()
+	value := p.expression()
+
+	p.consume(token.SEMICOLON, "Expect ';' after thrown value")
+	return stmt.NewThrow(keyword, value)
+}
+
+func (p *Parser) tryStatement() stmt.Stmt {
+	keyword := p.previous()
+
+	p.consume(token.LEFT_BRACE, "Expect '{' after try")
+	body := p.block()
+
+	var catchName *token.Token
+	var catchBody []stmt.Stmt
+	if p.match(token.CATCH) {
+		p.consume(token.LEFT_PAREN, "Expect '(' after catch")
+		name := p.consume(token.IDENTIFIER, "Expect exception variable name")
+		catchName = &name
+		p.consume(token.RIGHT_PAREN, "Expect ')' after exception variable name")
+
+		p.consume(token.LEFT_BRACE, "Expect '{' before catch body")
+		catchBody = p.block()
+	}
+
+	var finallyBody []stmt.Stmt
+	hasFinally := p.match(token.FINALLY)
+	if hasFinally {
+		p.consume(token.LEFT_BRACE, "Expect '{' after finally")
+		finallyBody = p.block()
+	}
+
+	if catchName == nil && !hasFinally {
+		p.error(keyword, "Expect 'catch' or 'finally' after try block")
+	}
+
+	return stmt.NewTry(keyword, body, catchName, catchBody, finallyBody)
+}
+
 func (p *Parser) block() []stmt.Stmt {
 	var statements []stmt.Stmt
 
 	for !p.check(token.RIGHT_BRACE) && !p.isAtEnd() {
-		decl, _ := p.declaration()
-		statements = append(statements, decl)
+		if decl, err := p.declaration(); err == nil {
+			statements = append(statements, decl)
+		}
 	}
 
 	p.consume(token.RIGHT_BRACE, "Expect '}' after block")
@@ -344,9 +482,11 @@ func (p *Parser) assignment() expr.Expr {
 			return expr.NewAssign(e.Name, value)
 		case *expr.Get:
 			return expr.NewSet(e.Object, e.Name, value)
+		case *expr.Index:
+			return expr.NewIndexSet(e.Object, e.Bracket, e.Index, value)
 		}
 
-		p.reporter.ParseError(equals, "Invalid assignment target") // report error, but continue
+		p.error(equals, "Invalid assignment target") // report error, but continue
 	}
 
 	return expression
@@ -450,6 +590,10 @@ func (p *Parser) call() expr.Expr {
 		} else if p.match(token.DOT) {
 			name := p.consume(token.IDENTIFIER, "Expected property name after '.'")
 			expression = expr.NewGet(expression, name)
+		} else if p.match(token.LEFT_BRACKET) {
+			index := p.expression()
+			bracket := p.consume(token.RIGHT_BRACKET, "Expected ']' after index")
+			expression = expr.NewIndex(expression, bracket, index)
 		} else {
 			break
 		}
@@ -462,7 +606,7 @@ func (p *Parser) arguments() []expr.Expr {
 	expressions := []expr.Expr{p.expression()}
 	for p.match(token.COMMA) {
 		if len(expressions) >= 255 {
-			p.reporter.ParseError(p.peek(), "Can't have more than 255 arguments")
+			p.error(p.peek(), "Can't have more than 255 arguments")
 		}
 		expressions = append(expressions, p.expression())
 	}
@@ -472,19 +616,23 @@ func (p *Parser) arguments() []expr.Expr {
 
 func (p *Parser) primary() expr.Expr {
 	if p.match(token.FALSE) {
-		return expr.NewLiteral(false)
+		return expr.NewLiteral(false, p.previous())
 	}
 
 	if p.match(token.TRUE) {
-		return expr.NewLiteral(true)
+		return expr.NewLiteral(true, p.previous())
 	}
 
 	if p.match(token.NIL) {
-		return expr.NewLiteral(nil)
+		return expr.NewLiteral(nil, p.previous())
 	}
 
 	if p.match(token.NUMBER, token.STRING) {
-		return expr.NewLiteral(p.previous().Literal)
+		return expr.NewLiteral(p.previous().Literal, p.previous())
+	}
+
+	if p.match(token.INTERPOLATION) {
+		return p.interpolation()
 	}
 
 	if p.match(token.IDENTIFIER) {
@@ -502,6 +650,32 @@ func (p *Parser) primary() expr.Expr {
 		return expr.NewSuper(keyword, method)
 	}
 
+	if p.match(token.FUN) {
+		keyword := p.previous()
+		p.consume(token.LEFT_PAREN, "Expect '(' after fun")
+		params := p.parameters("function")
+
+		p.consume(token.LEFT_BRACE, "Expect '{' before function body")
+		body := p.functionBody()
+
+		return expr.NewFunction(keyword, stmt.NewFunction(keyword, params, body))
+	}
+
+	if p.check(token.LEFT_PAREN) && p.isArrowFunction() {
+		p.advance()
+		params := p.parameters("function")
+		arrow := p.consume(token.ARROW, "Expect '=>' after parameters")
+
+		var body []stmt.Stmt
+		if p.match(token.LEFT_BRACE) {
+			body = p.functionBody()
+		} else {
+			body = []stmt.Stmt{stmt.NewReturn(arrow, p.expression())}
+		}
+
+		return expr.NewFunction(arrow, stmt.NewFunction(arrow, params, body))
+	}
+
 	if p.match(token.LEFT_PAREN) {
 		expression := p.expression()
 
@@ -510,10 +684,70 @@ func (p *Parser) primary() expr.Expr {
 		return expr.NewGrouping(expression)
 	}
 
-	p.reporter.ParseError(p.peek(), "Expect expression")
+	if p.match(token.LEFT_BRACKET) {
+		bracket := p.previous()
+
+		var elements []expr.Expr
+		if !p.check(token.RIGHT_BRACKET) {
+			elements = append(elements, p.expression())
+			for p.match(token.COMMA) {
+				elements = append(elements, p.expression())
+			}
+		}
+
+		closingBracket := p.consume(token.RIGHT_BRACKET, "Expected ']' after list elements")
+
+		return expr.NewList(bracket, elements, closingBracket)
+	}
+
+	if p.match(token.LEFT_BRACE) {
+		brace := p.previous()
+
+		var keys, values []expr.Expr
+		if !p.check(token.RIGHT_BRACE) {
+			for {
+				keys = append(keys, p.expression())
+				p.consume(token.COLON, "Expected ':' after map key")
+				values = append(values, p.expression())
+
+				if !p.match(token.COMMA) {
+					break
+				}
+			}
+		}
+
+		closingBrace := p.consume(token.RIGHT_BRACE, "Expected '}' after map entries")
+
+		return expr.NewMap(brace, keys, values, closingBrace)
+	}
+
+	p.error(p.peek(), "Expect expression")
 	panic("Parse Error")
 }
 
+func (p *Parser) interpolation() expr.Expr {
+	var parts []expr.Expr
+
+	for {
+		if literal := p.previous().Literal.(string); literal != "" {
+			parts = append(parts, expr.NewLiteral(literal, p.previous()))
+		}
+
+		parts = append(parts, p.expression())
+
+		if !p.match(token.INTERPOLATION_MIDDLE) {
+			break
+		}
+	}
+
+	end := p.consume(token.INTERPOLATION_END, "Expect '}' after interpolated expression")
+	if literal := end.Literal.(string); literal != "" {
+		parts = append(parts, expr.NewLiteral(literal, end))
+	}
+
+	return expr.NewInterpolation(parts)
+}
+
 func (p *Parser) match(types ...token.TokenType) bool {
 	for _, tokenType := range types {
 		if p.check(tokenType) {
@@ -530,6 +764,38 @@ func (p *Parser) check(tokenType token.TokenType) bool {
 	return p.peek().Type == tokenType
 }
 
+func (p *Parser) checkNext(tokenType token.TokenType) bool {
+	if p.isAtEnd() {
+		return false
+	}
+
+	return p.tokens[p.current+1].Type == tokenType
+}
+
+// isArrowFunction looks ahead from the current '(' for a parameter list followed by "=>".
+func (p *Parser) isArrowFunction() bool {
+	i := p.current + 1
+	if p.tokens[i].Type != token.RIGHT_PAREN {
+		for {
+			if p.tokens[i].Type != token.IDENTIFIER {
+				return false
+			}
+			i++
+
+			if p.tokens[i].Type != token.COMMA {
+				break
+			}
+			i++
+		}
+
+		if p.tokens[i].Type != token.RIGHT_PAREN {
+			return false
+		}
+	}
+
+	return p.tokens[i+1].Type == token.ARROW
+}
+
 func (p *Parser) advance() token.Token {
 	if !p.isAtEnd() {
 		p.current++
@@ -554,12 +820,17 @@ func (p *Parser) consume(tokenType token.TokenType, message string) token.Token
 	if p.check(tokenType) {
 		return p.advance()
 	}
-	p.reporter.ParseError(p.peek(), message)
+	p.error(p.peek(), message)
 
 	p.advance()
 	panic("Parse Error")
 }
 
+func (p *Parser) error(errToken token.Token, message string) {
+	p.hasError = true
+	p.reporter.ParseError(errToken, message)
+}
+
 func (p *Parser) synchronize() {
 	p.advance()
 	for !p.isAtEnd() {
@@ -0,0 +1,23 @@
+package reporter
+
+var _ ErrorReporter = (*Collector)(nil)
+
+// Collector keeps the diagnostics instead of printing them.
+type Collector struct {
+	diagnostics
+	Diagnostics []Diagnostic
+}
+
+func NewCollector() *Collector {
+	r := &Collector{}
+	r.add = func(diagnostic Diagnostic) {
+		r.Diagnostics = append(r.Diagnostics, diagnostic)
+	}
+
+	return r
+}
+
+// Reset removes all diagnostics.
+func (r *Collector) Reset() {
+	r.Diagnostics = nil
+}
@@ -12,23 +12,55 @@ type ConsoleReporter struct {
 	HadError bool
 }
 
-func (r *ConsoleReporter) LexingError(line int, message string) {
-	r.Report(line, "", message)
+func (r *ConsoleReporter) LexingError(span token.Span, message string) {
+	r.Report(span, "", message)
 }
 
 func (r *ConsoleReporter) ParseError(parsedToken token.Token, message string) {
-	if parsedToken.Type == token.EOF {
-		r.Report(parsedToken.Line, " at end", message)
-	} else {
-		r.Report(parsedToken.Line, fmt.Sprintf(" at '%s'", parsedToken.Lexeme), message)
-	}
+	r.Report(parsedToken.Span, where(parsedToken), message)
+}
+
+func (r *ConsoleReporter) ResolveError(resolvedToken token.Token, message string) {
+	r.Report(resolvedToken.Span, where(resolvedToken), message)
 }
 
-func (r *ConsoleReporter) RuntimeError(interpretedToken token.Token, message string) {
+func (r *ConsoleReporter) Warning(resolvedToken token.Token, message string) {
+	fmt.Printf("[line %d] Warning%s: %s\n", resolvedToken.Line, where(resolvedToken), message)
+	fmt.Print(Snippet(resolvedToken.Span))
+}
+
+func (r *ConsoleReporter) RuntimeError(interpretedToken token.Token, message string, trace []StackFrame) {
 	fmt.Printf("[line %d] RuntimeError: %s\n", interpretedToken.Line, message)
+	fmt.Print(Snippet(interpretedToken.Span))
+
+	if len(trace) <= 1 { // only top-level code
+		return
+	}
+
+	for i := 0; i < len(trace); {
+		fmt.Printf("    at %s\n", trace[i])
+
+		// collapse recursion
+		repeated := 0
+		for i++; i < len(trace) && trace[i] == trace[i-1]; i++ {
+			repeated++
+		}
+		if repeated > 0 {
+			fmt.Printf("    ... repeated %d more times\n", repeated)
+		}
+	}
 }
 
-func (r *ConsoleReporter) Report(line int, where, message string) {
-	fmt.Printf("[line %d] Error%s: %s\n", line, where, message)
+func (r *ConsoleReporter) Report(span token.Span, where, message string) {
+	fmt.Printf("[line %d] Error%s: %s\n", span.Line, where, message)
+	fmt.Print(Snippet(span))
 	r.HadError = true
 }
+
+func where(errToken token.Token) string {
+	if errToken.Type == token.EOF {
+		return " at end"
+	}
+
+	return fmt.Sprintf(" at '%s'", errToken.Lexeme)
+}
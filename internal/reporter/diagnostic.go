@@ -0,0 +1,69 @@
+package reporter
+
+import "github.com/fiurgeist/golox/internal/token"
+
+const (
+	PhaseLex     = "lex"
+	PhaseParse   = "parse"
+	PhaseResolve = "resolve"
+	PhaseRuntime = "runtime"
+)
+
+// Diagnostic is an error or warning with its location in a structured form.
+type Diagnostic struct {
+	Phase    string       `json:"phase,omitempty"` // empty for errors reported outside of a phase
+	Severity Severity     `json:"severity"`
+	File     string       `json:"file"` // empty if the source isn't read from a file
+	Line     int          `json:"line"`
+	Column   int          `json:"column"`
+	Message  string       `json:"message"`
+	Trace    []StackFrame `json:"trace,omitempty"` // innermost frame first
+}
+
+// diagnostics implements the ErrorReporter by passing each report as Diagnostic to add.
+type diagnostics struct {
+	add func(diagnostic Diagnostic)
+}
+
+func (r *diagnostics) LexingError(span token.Span, message string) {
+	r.report(Diagnostic{Phase: PhaseLex, Severity: SeverityError, Message: message}, span)
+}
+
+func (r *diagnostics) ParseError(parsedToken token.Token, message string) {
+	r.report(Diagnostic{Phase: PhaseParse, Severity: SeverityError, Message: message}, parsedToken.Span)
+}
+
+func (r *diagnostics) ResolveError(resolvedToken token.Token, message string) {
+	r.report(
+		Diagnostic{Phase: PhaseResolve, Severity: SeverityError, Message: message},
+		resolvedToken.Span,
+	)
+}
+
+func (r *diagnostics) Warning(resolvedToken token.Token, message string) {
+	r.report(
+		Diagnostic{Phase: PhaseResolve, Severity: SeverityWarning, Message: message},
+		resolvedToken.Span,
+	)
+}
+
+func (r *diagnostics) RuntimeError(interpretedToken token.Token, message string, trace []StackFrame) {
+	r.report(
+		Diagnostic{Phase: PhaseRuntime, Severity: SeverityError, Message: message, Trace: trace},
+		interpretedToken.Span,
+	)
+}
+
+func (r *diagnostics) Report(span token.Span, where, message string) {
+	r.report(Diagnostic{Severity: SeverityError, Message: message}, span)
+}
+
+func (r *diagnostics) report(diagnostic Diagnostic, span token.Span) {
+	if span.Source != nil {
+		diagnostic.File = span.Source.Path
+	}
+	diagnostic.Line = span.Line
+	diagnostic.Column = span.Column
+
+	r.add(diagnostic)
+}
@@ -0,0 +1,24 @@
+package reporter
+
+import (
+	"encoding/json"
+	"io"
+)
+
+var _ ErrorReporter = (*JSONReporter)(nil)
+
+// JSONReporter writes each Diagnostic as one JSON object per line.
+type JSONReporter struct {
+	diagnostics
+}
+
+func NewJSONReporter(writer io.Writer) *JSONReporter {
+	encoder := json.NewEncoder(writer)
+
+	r := &JSONReporter{}
+	r.add = func(diagnostic Diagnostic) {
+		encoder.Encode(diagnostic) // nothing left to report a failed write to
+	}
+
+	return r
+}
@@ -1,10 +1,43 @@
 package reporter
 
-import "github.com/fiurgeist/golox/internal/token"
+import (
+	"fmt"
+
+	"github.com/fiurgeist/golox/internal/token"
+)
+
+// Severity distinguishes errors, which stop the program from running, from warnings.
+type Severity string
+
+const (
+	SeverityError   Severity = "error"
+	SeverityWarning Severity = "warning"
+)
 
 type ErrorReporter interface {
-	LexingError(line int, message string)
+	LexingError(span token.Span, message string)
 	ParseError(token token.Token, message string)
-	RuntimeError(token token.Token, message string)
-	Report(line int, where, message string)
+	ResolveError(token token.Token, message string)
+	Warning(token token.Token, message string)
+	RuntimeError(token token.Token, message string, trace []StackFrame)
+	Report(span token.Span, where, message string)
+}
+
+// StackFrame is an entry of the call stack of a runtime error.
+type StackFrame struct {
+	Function string `json:"function,omitempty"` // empty for top-level code
+	Class    string `json:"class,omitempty"`    // empty for functions that aren't methods
+	Line     int    `json:"line"`
+}
+
+func (f StackFrame) String() string {
+	if f.Function == "" {
+		return fmt.Sprintf("script (line %d)", f.Line)
+	}
+
+	if f.Class == "" {
+		return fmt.Sprintf("%s() (line %d)", f.Function, f.Line)
+	}
+
+	return fmt.Sprintf("%s.%s() (line %d)", f.Class, f.Function, f.Line)
 }
@@ -0,0 +1,56 @@
+package reporter
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/fiurgeist/golox/internal/token"
+)
+
+// Snippet renders the source line of span with the span underlined:
+//
+//	 --> script.lox:3:9
+//	  |
+//	3 | print a b;
+//	  |         ^
+//
+// Spans covering multiple lines are only underlined up to the end of their first line.
+func Snippet(span token.Span) string {
+	if span.Source == nil || span.Offset > len(span.Source.Code) {
+		return ""
+	}
+
+	code := span.Source.Code
+	lineStart := bytes.LastIndexByte(code[:span.Offset], '\n') + 1
+	lineEnd := len(code)
+	if i := bytes.IndexByte(code[span.Offset:], '\n'); i != -1 {
+		lineEnd = span.Offset + i
+	}
+	end := min(span.Offset+span.Length, lineEnd)
+
+	var underline strings.Builder
+	for _, c := range string(code[lineStart:span.Offset]) {
+		if c == '\t' {
+			underline.WriteRune('\t') // keeps the alignment whatever the tab width
+		} else {
+			underline.WriteRune(' ')
+		}
+	}
+	underline.WriteRune('^')
+	underline.WriteString(strings.Repeat("~", max(utf8.RuneCount(code[span.Offset:end])-1, 0)))
+
+	gutter := fmt.Sprint(span.Line)
+	padding := strings.Repeat(" ", len(gutter))
+
+	var snippet strings.Builder
+	if span.Source.Path != "" {
+		fmt.Fprintf(&snippet, "%s--> %s:%d:%d\n", padding, span.Source.Path, span.Line, span.Column)
+	}
+	fmt.Fprintf(&snippet, "%s |\n", padding)
+	fmt.Fprintf(&snippet, "%s | %s\n", gutter, strings.TrimRight(string(code[lineStart:lineEnd]), "\r"))
+	fmt.Fprintf(&snippet, "%s | %s\n", padding, underline.String())
+
+	return snippet.String()
+}
@@ -1,40 +1,85 @@
 package resolver
 
 import (
+	"errors"
 	"fmt"
+	"sort"
 
 	"github.com/fiurgeist/golox/internal/ast/class"
 	"github.com/fiurgeist/golox/internal/ast/expr"
 	"github.com/fiurgeist/golox/internal/ast/function"
 	"github.com/fiurgeist/golox/internal/ast/stmt"
-	"github.com/fiurgeist/golox/internal/interpreter"
 	"github.com/fiurgeist/golox/internal/reporter"
 	"github.com/fiurgeist/golox/internal/token"
 )
 
+var ErrResolver = errors.New("ResolveError")
+
+// Warning is a kind of finding that doesn't prevent the program from running.
+type Warning string
+
+const WarnUnused Warning = "unused"
+
+// Resolver annotates variable expressions with their expr.Resolution. Slots are numbered in the
+// order the variables are declared in their scope.
 type Resolver struct {
-	interpreter     interpreter.Interpreter
-	reporter        reporter.ErrorReporter
-	scopes          []map[string]*variableStatus
-	currentFunction function.Type
-	currentClass    class.Type
+	reporter         reporter.ErrorReporter
+	hasError         bool
+	scopes           []map[string]*variableStatus
+	currentFunction  function.Type
+	currentClass     class.Type
+	warningsAsErrors bool
+	disabledWarnings map[Warning]bool
+}
+
+type Option func(*Resolver)
+
+// WithWarningsAsErrors reports warnings as errors, which fails the resolution.
+func WithWarningsAsErrors() Option {
+	return func(r *Resolver) {
+		r.warningsAsErrors = true
+	}
+}
+
+// WithoutWarning doesn't report the given kind of warning.
+func WithoutWarning(warning Warning) Option {
+	return func(r *Resolver) {
+		r.disabledWarnings[warning] = true
+	}
 }
 
 type variableStatus struct {
 	name    token.Token
+	slot    int
 	defined bool
 	used    bool
 }
 
-func NewResolver(interpreter interpreter.Interpreter, reporter reporter.ErrorReporter) Resolver {
-	return Resolver{
-		interpreter: interpreter,
-		reporter:    reporter,
-		scopes:      []map[string]*variableStatus{},
+func NewResolver(reporter reporter.ErrorReporter, options ...Option) Resolver {
+	resolver := Resolver{
+		reporter:         reporter,
+		scopes:           []map[string]*variableStatus{},
+		disabledWarnings: map[Warning]bool{},
+	}
+
+	for _, option := range options {
+		option(&resolver)
+	}
+
+	return resolver
+}
+
+func (r *Resolver) Resolve(statements []stmt.Stmt) error {
+	r.resolve(statements)
+
+	if r.hasError {
+		return ErrResolver
 	}
+
+	return nil
 }
 
-func (r *Resolver) Resolve(statements []stmt.Stmt) {
+func (r *Resolver) resolve(statements []stmt.Stmt) {
 	for _, statement := range statements {
 		r.resolveStmt(statement)
 	}
@@ -54,33 +99,60 @@ func (r *Resolver) resolveStmt(statement stmt.Stmt) {
 		r.resolveExpr(s.Expression)
 	case *stmt.Block:
 		r.beginScope()
-		r.Resolve(s.Statements)
+		r.resolve(s.Statements)
 		r.endScope()
 	case *stmt.If:
 		r.resolveExpr(s.Condition)
 		r.resolveStmt(s.ThenBranch)
 		if s.ElseBranch != nil {
-			r.resolveStmt(s.ThenBranch)
+			r.resolveStmt(s.ElseBranch)
 		}
 	case *stmt.While:
 		r.resolveExpr(s.Condition)
 		r.resolveStmt(s.Body)
+		if s.Increment != nil {
+			r.resolveExpr(s.Increment)
+		}
 	case *stmt.Break:
 		break
+	case *stmt.Continue:
+		break
 	case *stmt.Function:
 		r.declare(s.Name)
 		r.define(s.Name)
 		r.resolveFunction(s, function.FUNCTION)
 	case *stmt.Return:
 		if r.currentFunction == function.NONE {
-			r.reporter.ParseError(s.Keyword, "Can't return from top-level code")
+			r.error(s.Keyword, "Can't return from top-level code")
 		}
 		if s.Value != nil {
 			if r.currentFunction == function.INITIALIZER {
-				r.reporter.ParseError(s.Keyword, "Can't return a value from an initializer")
+				r.error(s.Keyword, "Can't return a value from an initializer")
 			}
 			r.resolveExpr(s.Value)
 		}
+	case *stmt.Import:
+		r.declare(s.Name)
+		r.define(s.Name)
+	case *stmt.Throw:
+		r.resolveExpr(s.Value)
+	case *stmt.Try:
+		r.beginScope()
+		r.resolve(s.Body)
+		r.endScope()
+
+		if s.CatchName != nil {
+			r.beginScope()
+			r.declare(*s.CatchName)
+			r.define(*s.CatchName)
+			r.scopes[0][s.CatchName.Lexeme].used = true // ignoring the exception is fine
+			r.resolve(s.CatchBody)
+			r.endScope()
+		}
+
+		r.beginScope()
+		r.resolve(s.FinallyBody)
+		r.endScope()
 	case *stmt.Class:
 		enclosingClass := r.currentClass
 		r.currentClass = class.CLASS
@@ -91,7 +163,7 @@ func (r *Resolver) resolveStmt(statement stmt.Stmt) {
 		if s.Superclass != nil {
 			r.currentClass = class.SUBCLASS
 			if s.Name.Lexeme == s.Superclass.Name.Lexeme {
-				r.reporter.ParseError(s.Superclass.Name, "A class can't inherit from itself")
+				r.error(s.Superclass.Name, "A class can't inherit from itself")
 			}
 			r.resolveExpr(s.Superclass)
 
@@ -139,13 +211,13 @@ func (r *Resolver) resolveExpr(expression expr.Expr) {
 	case *expr.Variable:
 		if len(r.scopes) != 0 {
 			if val, ok := r.scopes[0][e.Name.Lexeme]; ok && !val.defined {
-				r.reporter.ParseError(e.Name, "Can't read local variable in its own initializer")
+				r.error(e.Name, "Can't read local variable in its own initializer")
 			}
 		}
-		r.resolveLocal(e, e.Name)
+		e.Resolution = r.resolveLocal(e.Name)
 	case *expr.Assign:
 		r.resolveExpr(e.Value)
-		r.resolveLocal(e, e.Name)
+		e.Resolution = r.resolveLocal(e.Name)
 	case *expr.Call:
 		r.resolveExpr(e.Callee)
 
@@ -157,31 +229,55 @@ func (r *Resolver) resolveExpr(expression expr.Expr) {
 	case *expr.Set:
 		r.resolveExpr(e.Object)
 		r.resolveExpr(e.Value)
+	case *expr.List:
+		for _, element := range e.Elements {
+			r.resolveExpr(element)
+		}
+	case *expr.Function:
+		r.resolveFunction(e.Declaration.(*stmt.Function), function.FUNCTION)
+	case *expr.Interpolation:
+		for _, part := range e.Parts {
+			r.resolveExpr(part)
+		}
+	case *expr.Map:
+		for idx, key := range e.Keys {
+			r.resolveExpr(key)
+			r.resolveExpr(e.Values[idx])
+		}
+	case *expr.Index:
+		r.resolveExpr(e.Object)
+		r.resolveExpr(e.Index)
+	case *expr.IndexSet:
+		r.resolveExpr(e.Object)
+		r.resolveExpr(e.Index)
+		r.resolveExpr(e.Value)
 	case *expr.This:
 		if r.currentClass == class.NONE {
-			r.reporter.ParseError(e.Keyword, "Can't use 'this' outside of a class")
+			r.error(e.Keyword, "Can't use 'this' outside of a class")
 		}
-		r.resolveLocal(e, e.Keyword)
+		e.Resolution = r.resolveLocal(e.Keyword)
 	case *expr.Super:
 		if r.currentClass == class.NONE {
-			r.reporter.ParseError(e.Keyword, "Can't use 'super' outside of a class")
+			r.error(e.Keyword, "Can't use 'super' outside of a class")
 		} else if r.currentClass != class.SUBCLASS {
-			r.reporter.ParseError(e.Keyword, "Can't use 'super' in a class with no superclass")
+			r.error(e.Keyword, "Can't use 'super' in a class with no superclass")
 		}
-		r.resolveLocal(e, e.Keyword)
+		e.Resolution = r.resolveLocal(e.Keyword)
 	default:
 		panic(fmt.Sprintf("Unhandled expr %#v", expression))
 	}
 }
 
-func (r *Resolver) resolveLocal(expression expr.Expr, name token.Token) {
+// resolveLocal finds the innermost scope declaring name, it's a global if there is none.
+func (r *Resolver) resolveLocal(name token.Token) expr.Resolution {
 	for i, scope := range r.scopes {
 		if val, ok := scope[name.Lexeme]; ok && val.defined {
-			r.interpreter.Resolve(expression, i)
 			val.used = true
-			return
+			return expr.Resolution{Local: true, Depth: i, Slot: val.slot}
 		}
 	}
+
+	return expr.Resolution{}
 }
 
 func (r *Resolver) resolveFunction(function *stmt.Function, functionType function.Type) {
@@ -193,22 +289,48 @@ func (r *Resolver) resolveFunction(function *stmt.Function, functionType functio
 		r.declare(param)
 		r.define(param)
 	}
-	r.Resolve(function.Body)
+	r.resolve(function.Body)
 	r.endScope()
 
 	r.currentFunction = enclosingType
 }
 
+func (r *Resolver) error(name token.Token, message string) {
+	r.hasError = true
+	r.reporter.ResolveError(name, message)
+}
+
+func (r *Resolver) warning(warning Warning, name token.Token, message string) {
+	if r.disabledWarnings[warning] {
+		return
+	}
+
+	if r.warningsAsErrors {
+		r.error(name, message)
+		return
+	}
+
+	r.reporter.Warning(name, message)
+}
+
 func (r *Resolver) beginScope() {
 	r.scopes = append([]map[string]*variableStatus{{}}, r.scopes...)
 }
 
 func (r *Resolver) endScope() {
+	var unused []token.Token
 	for _, stat := range r.scopes[0] {
 		if !stat.used {
-			r.reporter.ParseError(stat.name, "Local variable is unused")
+			unused = append(unused, stat.name)
 		}
 	}
+
+	// report in source order, independent of the map iteration
+	sort.Slice(unused, func(a, b int) bool { return unused[a].Offset < unused[b].Offset })
+	for _, name := range unused {
+		r.warning(WarnUnused, name, "Local variable is unused")
+	}
+
 	r.scopes = r.scopes[1:]
 }
 
@@ -219,10 +341,10 @@ func (r *Resolver) declare(name token.Token) {
 
 	scope := r.scopes[0]
 	if val, ok := scope[name.Lexeme]; ok && val.defined {
-		r.reporter.ParseError(name, "Already a variable with this name in this scope")
+		r.error(name, "Already a variable with this name in this scope")
 	}
 
-	scope[name.Lexeme] = &variableStatus{name: name}
+	scope[name.Lexeme] = &variableStatus{name: name, slot: len(scope)}
 }
 
 func (r *Resolver) define(name token.Token) {
@@ -13,6 +13,9 @@ const (
 	RIGHT_PAREN
 	LEFT_BRACE
 	RIGHT_BRACE
+	LEFT_BRACKET
+	RIGHT_BRACKET
+	COLON
 	COMMA
 	DOT
 	MINUS
@@ -26,6 +29,7 @@ const (
 	BANG_EQUAL
 	EQUAL
 	EQUAL_EQUAL
+	ARROW
 	GREATER
 	GREATER_EQUAL
 	LESS
@@ -34,66 +38,183 @@ const (
 	// Literals
 	IDENTIFIER
 	STRING
+	INTERPOLATION        // string part in front of a "${"
+	INTERPOLATION_MIDDLE // string part between a '}' and the next "${"
+	INTERPOLATION_END    // string part after the last '}'
 	NUMBER
 
 	// Keywords
 	AND
+	AS
 	BREAK
+	CATCH
 	CLASS
+	CONTINUE
 	ELSE
 	FALSE
+	FINALLY
 	FUN
 	FOR
 	IF
+	IMPORT
 	NIL
 	OR
 	PRINT
 	RETURN
 	SUPER
 	THIS
+	THROW
 	TRUE
+	TRY
 	VAR
 	WHILE
 
 	EOF
 )
 
+var names = map[TokenType]string{
+	LEFT_PAREN:           "LEFT_PAREN",
+	RIGHT_PAREN:          "RIGHT_PAREN",
+	LEFT_BRACE:           "LEFT_BRACE",
+	RIGHT_BRACE:          "RIGHT_BRACE",
+	LEFT_BRACKET:         "LEFT_BRACKET",
+	RIGHT_BRACKET:        "RIGHT_BRACKET",
+	COLON:                "COLON",
+	COMMA:                "COMMA",
+	DOT:                  "DOT",
+	MINUS:                "MINUS",
+	PLUS:                 "PLUS",
+	SEMICOLON:            "SEMICOLON",
+	SLASH:                "SLASH",
+	STAR:                 "STAR",
+	BANG:                 "BANG",
+	BANG_EQUAL:           "BANG_EQUAL",
+	EQUAL:                "EQUAL",
+	EQUAL_EQUAL:          "EQUAL_EQUAL",
+	ARROW:                "ARROW",
+	GREATER:              "GREATER",
+	GREATER_EQUAL:        "GREATER_EQUAL",
+	LESS:                 "LESS",
+	LESS_EQUAL:           "LESS_EQUAL",
+	IDENTIFIER:           "IDENTIFIER",
+	STRING:               "STRING",
+	INTERPOLATION:        "INTERPOLATION",
+	INTERPOLATION_MIDDLE: "INTERPOLATION_MIDDLE",
+	INTERPOLATION_END:    "INTERPOLATION_END",
+	NUMBER:               "NUMBER",
+	AND:                  "AND",
+	AS:                   "AS",
+	BREAK:                "BREAK",
+	CATCH:                "CATCH",
+	CLASS:                "CLASS",
+	CONTINUE:             "CONTINUE",
+	ELSE:                 "ELSE",
+	FALSE:                "FALSE",
+	FINALLY:              "FINALLY",
+	FUN:                  "FUN",
+	FOR:                  "FOR",
+	IF:                   "IF",
+	IMPORT:               "IMPORT",
+	NIL:                  "NIL",
+	OR:                   "OR",
+	PRINT:                "PRINT",
+	RETURN:               "RETURN",
+	SUPER:                "SUPER",
+	THIS:                 "THIS",
+	THROW:                "THROW",
+	TRUE:                 "TRUE",
+	TRY:                  "TRY",
+	VAR:                  "VAR",
+	WHILE:                "WHILE",
+	EOF:                  "EOF",
+}
+
+func (t TokenType) String() string {
+	if name, ok := names[t]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("TokenType(%d)", int(t))
+}
+
 var Keywords = map[string]TokenType{
-	"and":    AND,
-	"break":  BREAK,
-	"class":  CLASS,
-	"else":   ELSE,
-	"false":  FALSE,
-	"fun":    FUN,
-	"for":    FOR,
-	"if":     IF,
-	"nil":    NIL,
-	"or":     OR,
-	"print":  PRINT,
-	"return": RETURN,
-	"super":  SUPER,
-	"this":   THIS,
-	"true":   TRUE,
-	"var":    VAR,
-	"while":  WHILE,
+	"and":      AND,
+	"as":       AS,
+	"break":    BREAK,
+	"catch":    CATCH,
+	"class":    CLASS,
+	"continue": CONTINUE,
+	"else":     ELSE,
+	"false":    FALSE,
+	"finally":  FINALLY,
+	"fun":      FUN,
+	"for":      FOR,
+	"if":       IF,
+	"import":   IMPORT,
+	"nil":      NIL,
+	"or":       OR,
+	"print":    PRINT,
+	"return":   RETURN,
+	"super":    SUPER,
+	"this":     THIS,
+	"throw":    THROW,
+	"true":     TRUE,
+	"try":      TRY,
+	"var":      VAR,
+	"while":    WHILE,
 }
 
 type Token struct {
 	Type    TokenType
 	Lexeme  string
 	Literal interface{}
-	Line    int
+	Span
 }
 
 func NewToken(
 	tokenType TokenType,
 	lexeme string,
 	literal interface{},
-	line int,
+	span Span,
 ) Token {
-	return Token{Type: tokenType, Lexeme: lexeme, Literal: literal, Line: line}
+	return Token{Type: tokenType, Lexeme: lexeme, Literal: literal, Span: span}
 }
 
 func (t *Token) String() string {
-	return fmt.Sprintf("%d %s %s", t.Type, t.Lexeme, t.Literal)
+	switch literal := t.Literal.(type) {
+	case nil:
+		return fmt.Sprintf("%s %s", t.Type, t.Lexeme)
+	case string:
+		return fmt.Sprintf("%s %s %q", t.Type, t.Lexeme, literal)
+	}
+
+	return fmt.Sprintf("%s %s %v", t.Type, t.Lexeme, t.Literal)
+}
+
+// Source is a script the spans of its tokens refer to.
+type Source struct {
+	Path string // empty if not read from a file
+	Code []byte
+}
+
+// Span locates a token or a syntax node in its source.
+type Span struct {
+	Source *Source
+	Line   int
+	Column int // 1-based, counted in characters
+	Offset int // in bytes
+	Length int // in bytes
+}
+
+// To extends s up to the end of end.
+func (s Span) To(end Span) Span {
+	if s.Source == nil {
+		return end
+	}
+
+	if end.Source == s.Source && end.Offset+end.Length > s.Offset {
+		s.Length = end.Offset + end.Length - s.Offset
+	}
+
+	return s
 }
@@ -0,0 +1,55 @@
+package vm
+
+import (
+	"strings"
+
+	"github.com/fiurgeist/golox/internal/core"
+)
+
+// Approximate sizes in bytes of the allocations accounted for by the allocation limit, the same
+// as in the tree-walking interpreter.
+const (
+	valueSize    = 16 // of an interface{} in a list or a global variable
+	entrySize    = 48 // of a key and value in a Go map, like a field
+	listSize     = 40
+	mapSize      = 64
+	instanceSize = 64
+	functionSize = 64
+)
+
+// WithMaxAllocation limits the approximate number of bytes allocated for strings, instances,
+// closures, lists and maps in total. It's a budget for the whole execution, not a limit of the
+// memory in use: memory that is garbage collected again isn't given back. Local variables live
+// on the value stack and aren't counted.
+func WithMaxAllocation(bytes int) Option {
+	return func(vm *VM) {
+		vm.limit().MaxAllocation = bytes
+	}
+}
+
+// allocate accounts for size bytes about to be allocated by the current instruction. Unlike the
+// other limits, an exceeded allocation limit is a runtime error scripts can catch, the failed
+// allocation isn't counted.
+func (vm *VM) allocate(size int) {
+	if vm.limits == nil {
+		return
+	}
+
+	if err := vm.limits.Allocate(size); err != nil {
+		panic(runtimeError(err.Error()))
+	}
+}
+
+// join concatenates the stringified parts of an interpolated string, the string is accounted for
+// before it's built.
+func (vm *VM) join(parts []interface{}) string {
+	stringified := make([]string, len(parts))
+	size := 0
+	for i, part := range parts {
+		stringified[i] = core.Stringify(part)
+		size += len(stringified[i])
+	}
+	vm.allocate(size)
+
+	return strings.Join(stringified, "")
+}
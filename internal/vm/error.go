@@ -0,0 +1,130 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/fiurgeist/golox/internal/core"
+	"github.com/fiurgeist/golox/internal/reporter"
+	"github.com/fiurgeist/golox/internal/token"
+)
+
+// runtimeError is panicked by operations failing at the current instruction, the run loop
+// locates it before the stack unwinds.
+type runtimeError string
+
+// operandError locates a runtime error at the operand of the current instruction at offset
+// instead of its last byte, like the name of an invoked method.
+type operandError struct {
+	message string
+	offset  int
+}
+
+// RuntimeError is a located runtime error on its way to a handler or to Interpret.
+type RuntimeError struct {
+	Span    token.Span
+	Message string
+	Trace   []reporter.StackFrame // attached when it is first caught
+}
+
+// exception is a thrown value, or a caught runtime error converted to an error object. Handlers
+// push it to the stack, where OpCatch unwraps the value and OpRethrow throws it again.
+type exception struct {
+	value interface{}
+	span  token.Span
+	err   *RuntimeError         // the caught runtime error, rethrown as it was
+	trace []reporter.StackFrame // attached when it is first caught
+}
+
+// raised is what OpRethrow panics with.
+func (e *exception) raised() interface{} {
+	if e.err != nil {
+		return e.err
+	}
+
+	return e
+}
+
+// thrown is what OpThrow panics with, a caught runtime error is raised again as it was.
+func (vm *VM) thrown(value interface{}) interface{} {
+	if instance, ok := value.(*Instance); ok && instance.err != nil {
+		return instance.err
+	}
+
+	return &exception{value: value, span: vm.span()}
+}
+
+// LimitError stops the execution when a limit is exceeded, it can't be caught.
+type LimitError struct {
+	RuntimeError
+	Err error
+}
+
+// runtimeErrorClass is the class of the error objects runtime errors get converted to when caught.
+var runtimeErrorClass = &Class{name: core.ErrorClass, methods: map[string]*Closure{}}
+
+func newErrorObject(err *RuntimeError) *Instance {
+	return &Instance{
+		class:  runtimeErrorClass,
+		fields: core.ErrorFields(err.Message, err.Span.Line),
+		err:    err,
+	}
+}
+
+func exceptionMessage(value interface{}) string {
+	var fields map[string]interface{}
+	if instance, ok := value.(*Instance); ok {
+		fields = instance.fields
+	}
+
+	return core.ExceptionMessage(value, fields)
+}
+
+// span returns the location of the last byte read of the current instruction.
+func (vm *VM) span() token.Span {
+	frame := &vm.frames[len(vm.frames)-1]
+	return frame.closure.function.Chunk.Span(frame.ip - 1)
+}
+
+// report reports an error that unwound everything and returns the error for Interpret.
+func (vm *VM) report(p interface{}) error {
+	var span token.Span
+	var message string
+	var trace []reporter.StackFrame
+	err := ErrRuntime
+
+	switch e := p.(type) {
+	case *RuntimeError:
+		span, message, trace = e.Span, e.Message, e.Trace
+	case *LimitError:
+		span, message, err = e.Span, e.Message, e.Err
+	case *exception:
+		span, message, trace = e.span, fmt.Sprintf("Uncaught exception: %s", exceptionMessage(e.value)), e.trace
+	default:
+		panic(p)
+	}
+
+	if trace == nil {
+		trace = vm.stackTrace(span.Line)
+	}
+	vm.reporter.RuntimeError(token.Token{Span: span}, message, trace)
+	return err
+}
+
+// stackTrace lists the frames of the call stack innermost first, starting at line. Like in the
+// tree-walking interpreter, top-level code of imported modules doesn't get a frame.
+func (vm *VM) stackTrace(line int) []reporter.StackFrame {
+	trace := make([]reporter.StackFrame, 0, len(vm.frames))
+	for idx := len(vm.frames) - 1; idx > 0; idx-- {
+		function := vm.frames[idx].closure.function
+		if function.Name == "" {
+			continue
+		}
+
+		trace = append(trace, reporter.StackFrame{Function: function.Name, Class: function.Class, Line: line})
+
+		caller := &vm.frames[idx-1]
+		line = caller.closure.function.Chunk.Span(caller.ip - 1).Line
+	}
+
+	return append(trace, reporter.StackFrame{Line: line})
+}
@@ -0,0 +1,70 @@
+package vm
+
+import (
+	"context"
+	"time"
+
+	"github.com/fiurgeist/golox/internal/core"
+)
+
+var (
+	ErrStepLimit = core.ErrStepLimit
+	ErrTimeout   = core.ErrTimeout
+	ErrCancelled = core.ErrCancelled
+)
+
+// WithMaxSteps limits the number of executed instructions.
+func WithMaxSteps(steps int) Option {
+	return func(vm *VM) {
+		vm.limit().MaxSteps = steps
+	}
+}
+
+// WithTimeout limits the wall-clock time the execution may take.
+func WithTimeout(timeout time.Duration) Option {
+	return func(vm *VM) {
+		vm.limit().Timeout = timeout
+	}
+}
+
+// WithContext stops the execution when the context is cancelled or its deadline passes.
+func WithContext(ctx context.Context) Option {
+	return func(vm *VM) {
+		vm.limit().Ctx = ctx
+	}
+}
+
+func (vm *VM) limit() *core.Limits {
+	if vm.limits == nil {
+		vm.limits = &core.Limits{}
+	}
+
+	return vm.limits
+}
+
+// startLimits resets the step count and the deadline for a call of Interpret, the returned
+// function ends it.
+func (vm *VM) startLimits() (stop func()) {
+	if vm.limits == nil {
+		return func() {}
+	}
+
+	return vm.limits.Start()
+}
+
+// step counts the instruction about to be executed and panics with a LimitError if a limit is
+// exceeded.
+func (vm *VM) step() {
+	exceeded := vm.limits.Step()
+	if exceeded == nil {
+		return
+	}
+
+	frame := &vm.frames[len(vm.frames)-1]
+	span := frame.closure.function.Chunk.Span(frame.ip)
+	if span.Source == nil {
+		return // like the implicit return of a script, the error is raised at the next instruction with a location
+	}
+
+	panic(&LimitError{RuntimeError: RuntimeError{Span: span, Message: exceeded.Message}, Err: exceeded.Err})
+}
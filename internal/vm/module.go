@@ -0,0 +1,61 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/fiurgeist/golox/internal/compiler"
+	"github.com/fiurgeist/golox/internal/lexer"
+	"github.com/fiurgeist/golox/internal/parser"
+	"github.com/fiurgeist/golox/internal/resolver"
+	"github.com/fiurgeist/golox/internal/token"
+)
+
+// importModule compiles and runs the module on top of the current frames, its runtime errors
+// propagate to the importing module.
+func (vm *VM) importModule(importer *Module, path string) *Module {
+	module, err := vm.modules.Load(importer.file, path, func(path string, source *token.Source) (interface{}, error) {
+		function := vm.compile(source)
+		if function == nil {
+			return nil, fmt.Errorf("Failed to import '%s'", source.Path)
+		}
+
+		module := newModule(source.Path, path)
+		closure := &Closure{function: function, module: module}
+		vm.push(closure)
+		vm.call(closure, 0)
+		vm.run(len(vm.frames) - 1)
+
+		return module, nil
+	})
+	if err != nil {
+		panic(runtimeError(err.Error()))
+	}
+
+	return module.(*Module)
+}
+
+// compile returns nil if the module has errors, which are reported.
+func (vm *VM) compile(source *token.Source) *compiler.Function {
+	lexer := lexer.NewLexer(source, vm.reporter)
+	tokens, errLex := lexer.ScanTokens()
+
+	parser := parser.NewParser(tokens, vm.reporter)
+	statements, errParse := parser.Parse()
+
+	if errLex != nil || errParse != nil {
+		return nil
+	}
+
+	resolver := resolver.NewResolver(vm.reporter, vm.resolverOptions...)
+	if err := resolver.Resolve(statements); err != nil {
+		return nil
+	}
+
+	compiler := compiler.NewCompiler(vm.reporter)
+	function, err := compiler.Compile(statements)
+	if err != nil {
+		return nil
+	}
+
+	return function
+}
@@ -0,0 +1,98 @@
+package vm
+
+import (
+	"fmt"
+	"time"
+	"unicode/utf8"
+
+	"github.com/fiurgeist/golox/internal/core"
+)
+
+// natives are defined in the builtins of every module.
+var natives = map[string]*Native{
+	"clock": {arity: 0, fn: func(vm *VM, arguments []interface{}) interface{} {
+		return float64(time.Now().UnixMilli())
+	}},
+	"len": {arity: 1, fn: func(vm *VM, arguments []interface{}) interface{} {
+		switch value := arguments[0].(type) {
+		case *core.List:
+			return float64(len(value.Elements))
+		case *core.Map:
+			return float64(value.Len())
+		case string:
+			return float64(utf8.RuneCountInString(value))
+		}
+
+		panic(runtimeError(fmt.Sprintf("Can't get length of '%s'", loxType(arguments[0]))))
+	}},
+	"push": {arity: 2, fn: func(vm *VM, arguments []interface{}) interface{} {
+		list := listArgument(arguments[0])
+		vm.allocate(valueSize)
+		list.Elements = append(list.Elements, arguments[1])
+		return nil
+	}},
+	"pop": {arity: 1, fn: func(vm *VM, arguments []interface{}) interface{} {
+		list := listArgument(arguments[0])
+		if len(list.Elements) == 0 {
+			panic(runtimeError("Can't pop from an empty list"))
+		}
+
+		last := list.Elements[len(list.Elements)-1]
+		list.Elements = list.Elements[:len(list.Elements)-1]
+		return last
+	}},
+	"keys": {arity: 1, fn: func(vm *VM, arguments []interface{}) interface{} {
+		m := mapArgument(arguments[0])
+		vm.allocate(listSize + m.Len()*valueSize)
+		return core.NewList(m.Keys())
+	}},
+	"values": {arity: 1, fn: func(vm *VM, arguments []interface{}) interface{} {
+		m := mapArgument(arguments[0])
+		vm.allocate(listSize + m.Len()*valueSize)
+		return core.NewList(m.Values())
+	}},
+	"has": {arity: 2, fn: func(vm *VM, arguments []interface{}) interface{} {
+		return mapHas(mapArgument(arguments[0]), arguments[1])
+	}},
+	"remove": {arity: 2, fn: func(vm *VM, arguments []interface{}) interface{} {
+		m := mapArgument(arguments[0])
+		checkHashable(arguments[1])
+
+		return m.Remove(arguments[1])
+	}},
+	"args": {arity: 0, fn: func(vm *VM, arguments []interface{}) interface{} {
+		elements := make([]interface{}, len(vm.args))
+		for i, arg := range vm.args {
+			elements[i] = arg
+		}
+
+		return core.NewList(elements)
+	}},
+}
+
+func listArgument(argument interface{}) *core.List {
+	list, ok := argument.(*core.List)
+	if !ok {
+		panic(runtimeError(fmt.Sprintf("Expected a list, got '%s'", loxType(argument))))
+	}
+
+	return list
+}
+
+func mapArgument(argument interface{}) *core.Map {
+	m, ok := argument.(*core.Map)
+	if !ok {
+		panic(runtimeError(fmt.Sprintf("Expected a map, got '%s'", loxType(argument))))
+	}
+
+	return m
+}
+
+func newBuiltins() map[string]interface{} {
+	builtins := make(map[string]interface{}, len(natives))
+	for name, native := range natives {
+		builtins[name] = native
+	}
+
+	return builtins
+}
@@ -0,0 +1,166 @@
+package vm
+
+import (
+	"fmt"
+
+	"github.com/fiurgeist/golox/internal/compiler"
+	"github.com/fiurgeist/golox/internal/core"
+)
+
+// Values are nil, float64, string, bool or one of the pointer types below.
+
+type Closure struct {
+	function *compiler.Function
+	upvalues []*Upvalue
+	module   *Module // the closure was created in, its globals are accessed
+}
+
+func (c *Closure) String() string {
+	return c.function.String()
+}
+
+// Upvalue is a variable captured by a closure. It refers to the stack slot of the variable until
+// the variable goes out of scope, then the value is moved into the upvalue.
+type Upvalue struct {
+	slot   int
+	open   bool
+	closed interface{}
+	next   *Upvalue // open upvalue of the next lower slot
+}
+
+func (u *Upvalue) get(vm *VM) interface{} {
+	if u.open {
+		return vm.stack[u.slot]
+	}
+
+	return u.closed
+}
+
+func (u *Upvalue) set(vm *VM, value interface{}) {
+	if u.open {
+		vm.stack[u.slot] = value
+	} else {
+		u.closed = value
+	}
+}
+
+type Class struct {
+	name    string
+	methods map[string]*Closure // including the inherited ones
+}
+
+func (c *Class) String() string {
+	return c.name
+}
+
+type Instance struct {
+	class  *Class
+	fields map[string]interface{}
+	err    *RuntimeError // the caught runtime error of an error object
+}
+
+func (i *Instance) String() string {
+	return fmt.Sprintf("%s instance", i.class.name)
+}
+
+// BoundMethod is a method accessed on an instance, which is 'this' when it's called.
+type BoundMethod struct {
+	receiver interface{}
+	method   *Closure
+}
+
+func (b *BoundMethod) String() string {
+	return b.method.String()
+}
+
+type Native struct {
+	arity int
+	fn    func(vm *VM, arguments []interface{}) interface{}
+}
+
+func (n *Native) String() string {
+	return "<native fn>"
+}
+
+// Module is the namespace object of an imported file exposing its global variables.
+type Module struct {
+	path     string // for display
+	file     string // relative imports are resolved against, empty for code not read from a file
+	globals  map[string]interface{}
+	builtins map[string]interface{} // the natives, looked up if a global isn't defined
+}
+
+func newModule(path, file string) *Module {
+	return &Module{path: path, file: file, globals: map[string]interface{}{}, builtins: newBuiltins()}
+}
+
+func (m *Module) String() string {
+	return fmt.Sprintf("<module %s>", m.path)
+}
+
+// checkHashable, checkIndex, mapGet, mapSet and mapHas raise the errors of core as runtime
+// errors.
+func checkHashable(key interface{}) {
+	if err := core.CheckHashable(key, loxType); err != nil {
+		panic(runtimeError(err.Error()))
+	}
+}
+
+func checkIndex(kind string, index interface{}, length int) int {
+	i, err := core.CheckIndex(kind, index, length, loxType)
+	if err != nil {
+		panic(runtimeError(err.Error()))
+	}
+
+	return i
+}
+
+func mapGet(m *core.Map, key interface{}) interface{} {
+	checkHashable(key)
+
+	value, err := m.Get(key)
+	if err != nil {
+		panic(runtimeError(err.Error()))
+	}
+
+	return value
+}
+
+func mapSet(m *core.Map, key interface{}, value interface{}) {
+	checkHashable(key)
+	m.Set(key, value)
+}
+
+func mapHas(m *core.Map, key interface{}) bool {
+	checkHashable(key)
+	return m.Has(key)
+}
+
+func loxType(value interface{}) string {
+	if value == nil {
+		return "nil"
+	}
+
+	switch value.(type) {
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case bool:
+		return "Boolean"
+	case *core.List:
+		return "list"
+	case *core.Map:
+		return "map"
+	case *Instance:
+		return "instance"
+	case *Class:
+		return "class"
+	case *Module:
+		return "module"
+	case *Closure, *BoundMethod, *Native:
+		return "function"
+	default:
+		panic(fmt.Sprintf("Unhandled type '%T'", value))
+	}
+}
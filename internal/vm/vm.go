@@ -0,0 +1,697 @@
+package vm
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/fiurgeist/golox/internal/compiler"
+	"github.com/fiurgeist/golox/internal/core"
+	"github.com/fiurgeist/golox/internal/reporter"
+	"github.com/fiurgeist/golox/internal/resolver"
+)
+
+var ErrRuntime = errors.New("RuntimeError")
+
+// VM executes the bytecode of compiled scripts on a stack of values.
+type VM struct {
+	reporter        reporter.ErrorReporter
+	stack           []interface{}
+	frames          []callFrame
+	handlers        []handler
+	openUpvalues    *Upvalue // sorted by slot, highest first
+	main            *Module  // the interpreted script
+	modules         *core.Loader
+	maxCallDepth    int
+	resolverOptions []resolver.Option // for imported modules
+	args            []string          // of the script, returned by the args() native
+	output          io.Writer         // of print statements
+	limits          *core.Limits      // nil without any limits
+}
+
+// callFrame is pushed for every call of a closure, including the top-level code of modules.
+type callFrame struct {
+	closure     *Closure
+	ip          int
+	base        int         // stack index of slot zero, the closure or 'this'
+	returnValue interface{} // stored by OpSetReturn while finally blocks run
+}
+
+// handler is pushed by OpTry, an exception resets the frames and the stack and continues at target.
+type handler struct {
+	frame  int
+	height int
+	target int
+}
+
+// DefaultMaxCallDepth is the same as for the tree-walking interpreter.
+const DefaultMaxCallDepth = 10000
+
+type Option func(*VM)
+
+// WithMaxCallDepth limits the number of nested calls before a stack overflow is reported.
+func WithMaxCallDepth(depth int) Option {
+	return func(vm *VM) {
+		vm.maxCallDepth = depth
+	}
+}
+
+// WithResolverOptions configures the resolution of imported modules.
+func WithResolverOptions(options ...resolver.Option) Option {
+	return func(vm *VM) {
+		vm.resolverOptions = options
+	}
+}
+
+// WithArgs sets the command line arguments of the script.
+func WithArgs(args []string) Option {
+	return func(vm *VM) {
+		vm.args = args
+	}
+}
+
+// WithPath sets the path of the interpreted file.
+func WithPath(path string) Option {
+	return func(vm *VM) {
+		vm.main.file = path
+	}
+}
+
+// WithOutput redirects print statements, which write to stdout by default.
+func WithOutput(output io.Writer) Option {
+	return func(vm *VM) {
+		vm.output = output
+	}
+}
+
+func NewVM(reporter reporter.ErrorReporter, options ...Option) VM {
+	vm := VM{
+		reporter:     reporter,
+		stack:        make([]interface{}, 0, 256),
+		main:         newModule("", ""),
+		modules:      core.NewLoader(),
+		maxCallDepth: DefaultMaxCallDepth,
+		output:       os.Stdout,
+	}
+
+	for _, option := range options {
+		option(&vm)
+	}
+
+	return vm
+}
+
+// Interpret runs a compiled script, runtime errors and uncaught exceptions are reported.
+func (vm *VM) Interpret(function *compiler.Function) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = vm.report(p)
+		}
+
+		vm.stack = vm.stack[:0]
+		vm.frames = vm.frames[:0]
+		vm.handlers = vm.handlers[:0]
+		vm.openUpvalues = nil
+	}()
+	defer vm.startLimits()()
+	defer vm.modules.Enter(vm.main.file)()
+
+	closure := &Closure{function: function, module: vm.main}
+	vm.push(closure)
+	vm.call(closure, 0)
+	vm.run(0)
+
+	return nil
+}
+
+// run executes instructions until the frame count drops to stop, returning the value returned by
+// the last frame. Exceptions are caught by the handlers of these frames.
+func (vm *VM) run(stop int) interface{} {
+	for {
+		if result, done := vm.execute(stop); done {
+			return result
+		}
+	}
+}
+
+// execute returns when the frame count drops to stop, or without being done after an exception
+// was caught.
+func (vm *VM) execute(stop int) (result interface{}, done bool) {
+	defer func() {
+		if p := recover(); p != nil {
+			vm.catch(p, stop)
+		}
+	}()
+
+	frame := &vm.frames[len(vm.frames)-1]
+	code, constants, globals := frame.closure.function.Chunk.Code, frame.closure.function.Chunk.Constants, frame.closure.module.globals
+
+	for {
+		if vm.limits != nil {
+			vm.step()
+		}
+
+		op := compiler.OpCode(code[frame.ip])
+		frame.ip++
+
+		switch op {
+		case compiler.OpConstant:
+			vm.push(constants[vm.readLong(frame)])
+		case compiler.OpNil:
+			vm.push(nil)
+		case compiler.OpTrue:
+			vm.push(true)
+		case compiler.OpFalse:
+			vm.push(false)
+		case compiler.OpPop:
+			vm.stack = vm.stack[:len(vm.stack)-1]
+		case compiler.OpGetLocal:
+			vm.push(vm.stack[frame.base+int(code[frame.ip])])
+			frame.ip++
+		case compiler.OpSetLocal:
+			vm.stack[frame.base+int(code[frame.ip])] = vm.peek(0)
+			frame.ip++
+		case compiler.OpGetGlobal:
+			name := constants[vm.readLong(frame)].(string)
+			value, ok := globals[name]
+			if !ok {
+				value, ok = frame.closure.module.builtins[name]
+			}
+			if !ok {
+				panic(runtimeError(fmt.Sprintf("Undefined variable '%s'", name)))
+			}
+			vm.push(value)
+		case compiler.OpDefineGlobal:
+			vm.allocate(valueSize)
+			globals[constants[vm.readLong(frame)].(string)] = vm.pop()
+		case compiler.OpSetGlobal:
+			name := constants[vm.readLong(frame)].(string)
+			if _, ok := globals[name]; ok {
+				globals[name] = vm.peek(0)
+			} else if _, ok := frame.closure.module.builtins[name]; ok {
+				frame.closure.module.builtins[name] = vm.peek(0)
+			} else {
+				panic(runtimeError(fmt.Sprintf("Undefined variable '%s'", name)))
+			}
+		case compiler.OpGetUpvalue:
+			vm.push(frame.closure.upvalues[code[frame.ip]].get(vm))
+			frame.ip++
+		case compiler.OpSetUpvalue:
+			frame.closure.upvalues[code[frame.ip]].set(vm, vm.peek(0))
+			frame.ip++
+		case compiler.OpGetLocalLong:
+			vm.push(vm.stack[frame.base+vm.readShort(frame)])
+		case compiler.OpSetLocalLong:
+			vm.stack[frame.base+vm.readShort(frame)] = vm.peek(0)
+		case compiler.OpGetUpvalueLong:
+			vm.push(frame.closure.upvalues[vm.readShort(frame)].get(vm))
+		case compiler.OpSetUpvalueLong:
+			frame.closure.upvalues[vm.readShort(frame)].set(vm, vm.peek(0))
+		case compiler.OpGetProperty:
+			name := constants[vm.readLong(frame)].(string)
+			vm.stack[len(vm.stack)-1] = vm.getProperty(frame, vm.peek(0), name)
+		case compiler.OpSetProperty:
+			name := constants[vm.readLong(frame)].(string)
+			value := vm.pop()
+			vm.setProperty(frame, vm.peek(0), name, value)
+			vm.stack[len(vm.stack)-1] = value
+		case compiler.OpGetSuper:
+			name := constants[vm.readLong(frame)].(string)
+			superclass := vm.pop().(*Class)
+			method, ok := superclass.methods[name]
+			if !ok {
+				panic(runtimeError(fmt.Sprintf("Undefined property '%s'", name)))
+			}
+			vm.stack[len(vm.stack)-1] = &BoundMethod{receiver: vm.peek(0), method: method}
+		case compiler.OpGetIndex:
+			index := vm.pop()
+			vm.stack[len(vm.stack)-1] = getIndex(vm.peek(0), index)
+		case compiler.OpSetIndex:
+			value := vm.pop()
+			index := vm.pop()
+			if m, ok := vm.peek(0).(*core.Map); ok && !mapHas(m, index) {
+				vm.allocate(entrySize)
+			}
+			setIndex(vm.peek(0), index, value)
+			vm.stack[len(vm.stack)-1] = value
+		case compiler.OpEqual:
+			b := vm.pop()
+			vm.stack[len(vm.stack)-1] = vm.peek(0) == b
+		case compiler.OpNotEqual:
+			b := vm.pop()
+			vm.stack[len(vm.stack)-1] = vm.peek(0) != b
+		case compiler.OpGreater:
+			a, b := vm.numberOperands()
+			vm.push(a > b)
+		case compiler.OpGreaterEqual:
+			a, b := vm.numberOperands()
+			vm.push(a >= b)
+		case compiler.OpLess:
+			a, b := vm.numberOperands()
+			vm.push(a < b)
+		case compiler.OpLessEqual:
+			a, b := vm.numberOperands()
+			vm.push(a <= b)
+		case compiler.OpAdd:
+			vm.add()
+		case compiler.OpSubtract:
+			a, b := vm.numberOperands()
+			vm.push(a - b)
+		case compiler.OpMultiply:
+			a, b := vm.numberOperands()
+			vm.push(a * b)
+		case compiler.OpDivide:
+			a, b := vm.numberOperands()
+			vm.push(a / b)
+		case compiler.OpNot:
+			vm.stack[len(vm.stack)-1] = !core.IsTruthy(vm.peek(0))
+		case compiler.OpNegate:
+			number, ok := vm.peek(0).(float64)
+			if !ok {
+				panic(runtimeError(fmt.Sprintf("Operand must be a number, got '%s'", loxType(vm.peek(0)))))
+			}
+			vm.stack[len(vm.stack)-1] = -number
+		case compiler.OpPrint:
+			fmt.Fprintln(vm.output, core.Stringify(vm.pop()))
+		case compiler.OpJump:
+			offset := vm.readLong(frame)
+			frame.ip += offset
+		case compiler.OpJumpIfFalse:
+			offset := vm.readLong(frame)
+			if !core.IsTruthy(vm.peek(0)) {
+				frame.ip += offset
+			}
+		case compiler.OpLoop:
+			offset := vm.readLong(frame)
+			frame.ip -= offset
+		case compiler.OpCall:
+			argCount := int(code[frame.ip])
+			frame.ip++
+			if !vm.callValue(vm.peek(argCount), argCount) {
+				source := frame.closure.function.Chunk.Source(frame.ip - 2)
+				panic(runtimeError(fmt.Sprintf("'%s' is not a function", source)))
+			}
+			frame = &vm.frames[len(vm.frames)-1]
+			code, constants, globals = frame.closure.function.Chunk.Code, frame.closure.function.Chunk.Constants, frame.closure.module.globals
+		case compiler.OpInvoke:
+			name := constants[vm.readLong(frame)].(string)
+			argCount := int(code[frame.ip])
+			frame.ip++
+			vm.invoke(frame, name, argCount)
+			frame = &vm.frames[len(vm.frames)-1]
+			code, constants, globals = frame.closure.function.Chunk.Code, frame.closure.function.Chunk.Constants, frame.closure.module.globals
+		case compiler.OpSuperInvoke:
+			name := constants[vm.readLong(frame)].(string)
+			argCount := int(code[frame.ip])
+			frame.ip++
+			superclass := vm.pop().(*Class)
+			method, ok := superclass.methods[name]
+			if !ok {
+				panic(operandError{message: fmt.Sprintf("Undefined property '%s'", name), offset: frame.ip - 2})
+			}
+			vm.call(method, argCount)
+			frame = &vm.frames[len(vm.frames)-1]
+			code, constants, globals = frame.closure.function.Chunk.Code, frame.closure.function.Chunk.Constants, frame.closure.module.globals
+		case compiler.OpClosure:
+			function := constants[vm.readLong(frame)].(*compiler.Function)
+			vm.allocate(functionSize)
+			closure := &Closure{function: function, module: frame.closure.module}
+			if function.UpvalueCount > 0 {
+				closure.upvalues = make([]*Upvalue, function.UpvalueCount)
+			}
+			for i := range closure.upvalues {
+				isLocal := code[frame.ip]
+				frame.ip++
+				index := vm.readShort(frame)
+				if isLocal == 1 {
+					closure.upvalues[i] = vm.captureUpvalue(frame.base + index)
+				} else {
+					closure.upvalues[i] = frame.closure.upvalues[index]
+				}
+			}
+			vm.push(closure)
+		case compiler.OpCloseUpvalue:
+			vm.closeUpvalues(len(vm.stack) - 1)
+			vm.stack = vm.stack[:len(vm.stack)-1]
+		case compiler.OpReturn, compiler.OpReturnPending:
+			var result interface{}
+			if op == compiler.OpReturn {
+				result = vm.pop()
+			} else {
+				result = frame.returnValue
+			}
+
+			vm.closeUpvalues(frame.base)
+			vm.stack = vm.stack[:frame.base]
+			vm.frames = vm.frames[:len(vm.frames)-1]
+			if len(vm.frames) == stop {
+				return result, true
+			}
+
+			vm.push(result)
+			frame = &vm.frames[len(vm.frames)-1]
+			code, constants, globals = frame.closure.function.Chunk.Code, frame.closure.function.Chunk.Constants, frame.closure.module.globals
+		case compiler.OpSetReturn:
+			frame.returnValue = vm.pop()
+		case compiler.OpClass:
+			name := constants[vm.readLong(frame)].(string)
+			vm.push(&Class{name: name, methods: map[string]*Closure{}})
+		case compiler.OpInherit:
+			class := vm.pop().(*Class)
+			superclass, ok := vm.peek(0).(*Class)
+			if !ok {
+				panic(runtimeError("Superclass must be a class"))
+			}
+			for name, method := range superclass.methods {
+				class.methods[name] = method
+			}
+		case compiler.OpMethod:
+			name := constants[vm.readLong(frame)].(string)
+			method := vm.pop().(*Closure)
+			vm.peek(0).(*Class).methods[name] = method
+		case compiler.OpList:
+			count := vm.readLong(frame)
+			vm.allocate(listSize + count*valueSize)
+			elements := make([]interface{}, count)
+			copy(elements, vm.stack[len(vm.stack)-count:])
+			vm.stack = vm.stack[:len(vm.stack)-count]
+			vm.push(core.NewList(elements))
+		case compiler.OpMap:
+			count := vm.readLong(frame)
+			vm.allocate(mapSize + count*entrySize)
+			m := core.NewMap()
+			entries := vm.stack[len(vm.stack)-2*count:]
+			for i := 0; i < count; i++ {
+				mapSet(m, entries[2*i], entries[2*i+1])
+			}
+			vm.stack = vm.stack[:len(vm.stack)-2*count]
+			vm.push(m)
+		case compiler.OpInterpolate:
+			count := vm.readLong(frame)
+			interpolated := vm.join(vm.stack[len(vm.stack)-count:])
+			vm.stack = vm.stack[:len(vm.stack)-count]
+			vm.push(interpolated)
+		case compiler.OpThrow:
+			panic(vm.thrown(vm.pop()))
+		case compiler.OpTry:
+			offset := vm.readLong(frame)
+			vm.handlers = append(vm.handlers, handler{
+				frame:  len(vm.frames) - 1,
+				height: len(vm.stack),
+				target: frame.ip + offset,
+			})
+		case compiler.OpEndTry:
+			vm.handlers = vm.handlers[:len(vm.handlers)-1]
+		case compiler.OpCatch:
+			vm.stack[len(vm.stack)-1] = vm.peek(0).(*exception).value
+		case compiler.OpRethrow:
+			panic(vm.pop().(*exception).raised())
+		case compiler.OpImport:
+			path := constants[vm.readLong(frame)].(string)
+			module := vm.importModule(frame.closure.module, path)
+			frame = &vm.frames[len(vm.frames)-1]
+			vm.push(module)
+		default:
+			panic(fmt.Sprintf("Unhandled instruction %s", op))
+		}
+	}
+}
+
+// catch continues at the innermost handler of the frames run since stop if the panic is an
+// exception or a runtime error, it's panicked again otherwise. Runtime errors are located while
+// the frame they occurred in is still on the stack, they are caught as error objects. The stack
+// trace is kept for when they are rethrown.
+func (vm *VM) catch(p interface{}, stop int) {
+	var thrown *exception
+	switch e := p.(type) {
+	case runtimeError:
+		err := &RuntimeError{Span: vm.span(), Message: string(e)}
+		p, thrown = err, &exception{value: newErrorObject(err), span: err.Span, err: err}
+	case operandError:
+		frame := &vm.frames[len(vm.frames)-1]
+		err := &RuntimeError{Span: frame.closure.function.Chunk.Span(e.offset), Message: e.message}
+		p, thrown = err, &exception{value: newErrorObject(err), span: err.Span, err: err}
+	case *RuntimeError:
+		thrown = &exception{value: newErrorObject(e), span: e.Span, err: e}
+	case *exception:
+		thrown = e
+	}
+
+	if thrown == nil || len(vm.handlers) == 0 || vm.handlers[len(vm.handlers)-1].frame < stop {
+		panic(p)
+	}
+
+	if thrown.err != nil && thrown.err.Trace == nil {
+		thrown.err.Trace = vm.stackTrace(thrown.span.Line)
+	} else if thrown.err == nil && thrown.trace == nil {
+		thrown.trace = vm.stackTrace(thrown.span.Line)
+	}
+
+	h := vm.handlers[len(vm.handlers)-1]
+	vm.handlers = vm.handlers[:len(vm.handlers)-1]
+	vm.frames = vm.frames[:h.frame+1]
+	vm.closeUpvalues(h.height)
+	vm.stack = vm.stack[:h.height]
+	vm.push(thrown)
+	vm.frames[h.frame].ip = h.target
+}
+
+func (vm *VM) push(value interface{}) {
+	vm.stack = append(vm.stack, value)
+}
+
+func (vm *VM) pop() interface{} {
+	value := vm.stack[len(vm.stack)-1]
+	vm.stack = vm.stack[:len(vm.stack)-1]
+	return value
+}
+
+func (vm *VM) peek(distance int) interface{} {
+	return vm.stack[len(vm.stack)-1-distance]
+}
+
+func (vm *VM) readShort(frame *callFrame) int {
+	code := frame.closure.function.Chunk.Code
+	frame.ip += 2
+	return int(code[frame.ip-2])<<8 | int(code[frame.ip-1])
+}
+
+func (vm *VM) readLong(frame *callFrame) int {
+	code := frame.closure.function.Chunk.Code
+	frame.ip += 3
+	return int(code[frame.ip-3])<<16 | int(code[frame.ip-2])<<8 | int(code[frame.ip-1])
+}
+
+func (vm *VM) numberOperands() (float64, float64) {
+	a, okA := vm.peek(1).(float64)
+	b, okB := vm.peek(0).(float64)
+	if !okA || !okB {
+		panic(runtimeError(fmt.Sprintf(
+			"Operands must be numbers, got '%s' and '%s'", loxType(vm.peek(1)), loxType(vm.peek(0)),
+		)))
+	}
+
+	vm.stack = vm.stack[:len(vm.stack)-2]
+	return a, b
+}
+
+func (vm *VM) add() {
+	switch a := vm.peek(1).(type) {
+	case float64:
+		if b, ok := vm.peek(0).(float64); ok {
+			vm.stack = vm.stack[:len(vm.stack)-1]
+			vm.stack[len(vm.stack)-1] = a + b
+			return
+		}
+	case string:
+		if b, ok := vm.peek(0).(string); ok {
+			vm.allocate(len(a) + len(b))
+			vm.stack = vm.stack[:len(vm.stack)-1]
+			vm.stack[len(vm.stack)-1] = a + b
+			return
+		}
+	}
+
+	panic(runtimeError(fmt.Sprintf(
+		"Operands must be two numbers or two strings, got '%s' and '%s'", loxType(vm.peek(1)), loxType(vm.peek(0)),
+	)))
+}
+
+// callValue calls the callee below the arguments on the stack, reports if it's callable at all.
+func (vm *VM) callValue(callee interface{}, argCount int) bool {
+	switch c := callee.(type) {
+	case *Closure:
+		vm.call(c, argCount)
+	case *BoundMethod:
+		vm.stack[len(vm.stack)-argCount-1] = c.receiver
+		vm.call(c.method, argCount)
+	case *Class:
+		vm.allocate(instanceSize)
+		vm.stack[len(vm.stack)-argCount-1] = &Instance{class: c, fields: map[string]interface{}{}}
+		if initializer, ok := c.methods["init"]; ok {
+			vm.call(initializer, argCount)
+		} else if argCount != 0 {
+			panic(runtimeError(fmt.Sprintf("Expected 0 arguments but got %d", argCount)))
+		}
+	case *Native:
+		if argCount != c.arity {
+			panic(runtimeError(fmt.Sprintf("Expected %d arguments but got %d", c.arity, argCount)))
+		}
+
+		result := c.fn(vm, vm.stack[len(vm.stack)-argCount:])
+		vm.stack = vm.stack[:len(vm.stack)-argCount]
+		vm.stack[len(vm.stack)-1] = result
+	default:
+		return false
+	}
+
+	return true
+}
+
+// call pushes the frame of a closure, its arguments are on top of the stack.
+func (vm *VM) call(closure *Closure, argCount int) {
+	if argCount != closure.function.Arity {
+		panic(runtimeError(fmt.Sprintf("Expected %d arguments but got %d", closure.function.Arity, argCount)))
+	}
+
+	if len(vm.frames) > vm.maxCallDepth {
+		panic(runtimeError("Stack overflow"))
+	}
+
+	vm.frames = append(vm.frames, callFrame{closure: closure, base: len(vm.stack) - argCount - 1})
+}
+
+// invoke calls a method without binding it first, fields holding a function are called as well.
+func (vm *VM) invoke(frame *callFrame, name string, argCount int) {
+	var callee interface{}
+
+	switch receiver := vm.peek(argCount).(type) {
+	case *Instance:
+		if field, ok := receiver.fields[name]; ok {
+			callee = field
+			break
+		}
+
+		method, ok := receiver.class.methods[name]
+		if !ok {
+			panic(operandError{message: fmt.Sprintf("Undefined property '%s'", name), offset: frame.ip - 2})
+		}
+
+		vm.call(method, argCount)
+		return
+	case *Module:
+		callee = vm.getProperty(frame, receiver, name)
+	default:
+		source := frame.closure.function.Chunk.Source(frame.ip - 5)
+		panic(operandError{message: fmt.Sprintf("'%s' is not an instance", source), offset: frame.ip - 2})
+	}
+
+	vm.stack[len(vm.stack)-argCount-1] = callee
+	if !vm.callValue(callee, argCount) {
+		panic(runtimeError(fmt.Sprintf("'%s' is not a function", name)))
+	}
+}
+
+func (vm *VM) getProperty(frame *callFrame, object interface{}, name string) interface{} {
+	switch o := object.(type) {
+	case *Instance:
+		if value, ok := o.fields[name]; ok {
+			return value
+		}
+
+		if method, ok := o.class.methods[name]; ok {
+			return &BoundMethod{receiver: o, method: method}
+		}
+
+		panic(operandError{message: fmt.Sprintf("Undefined property '%s'", name), offset: frame.ip - 2})
+	case *Module:
+		if value, ok := o.globals[name]; ok {
+			return value
+		}
+
+		panic(operandError{
+			message: fmt.Sprintf("Undefined property '%s' in module '%s'", name, o.path),
+			offset:  frame.ip - 2,
+		})
+	}
+
+	source := frame.closure.function.Chunk.Source(frame.ip - 4)
+	panic(runtimeError(fmt.Sprintf("'%s' is not an instance", source)))
+}
+
+func (vm *VM) setProperty(frame *callFrame, object interface{}, name string, value interface{}) {
+	switch o := object.(type) {
+	case *Instance:
+		if _, ok := o.fields[name]; !ok {
+			vm.allocate(entrySize)
+		}
+		o.fields[name] = value
+		return
+	case *Module:
+		panic(runtimeError(fmt.Sprintf("Can't assign to property '%s' of module '%s'", name, o.path)))
+	}
+
+	source := frame.closure.function.Chunk.Source(frame.ip - 4)
+	panic(runtimeError(fmt.Sprintf("'%s' is not an instance", source)))
+}
+
+func getIndex(object, index interface{}) interface{} {
+	switch o := object.(type) {
+	case *core.List:
+		return o.Elements[checkIndex("List", index, len(o.Elements))]
+	case *core.Map:
+		return mapGet(o, index)
+	case string:
+		runes := []rune(o)
+		return string(runes[checkIndex("String", index, len(runes))])
+	}
+
+	panic(runtimeError(fmt.Sprintf("'%s' is not indexable", loxType(object))))
+}
+
+func setIndex(object, index, value interface{}) {
+	switch o := object.(type) {
+	case *core.List:
+		o.Elements[checkIndex("List", index, len(o.Elements))] = value
+	case *core.Map:
+		mapSet(o, index, value)
+	case string:
+		panic(runtimeError("Strings are immutable"))
+	default:
+		panic(runtimeError(fmt.Sprintf("'%s' is not indexable", loxType(object))))
+	}
+}
+
+// captureUpvalue returns the open upvalue of the stack slot, which closures share.
+func (vm *VM) captureUpvalue(slot int) *Upvalue {
+	var previous *Upvalue
+	upvalue := vm.openUpvalues
+	for upvalue != nil && upvalue.slot > slot {
+		previous = upvalue
+		upvalue = upvalue.next
+	}
+
+	if upvalue != nil && upvalue.slot == slot {
+		return upvalue
+	}
+
+	created := &Upvalue{slot: slot, open: true, next: upvalue}
+	if previous == nil {
+		vm.openUpvalues = created
+	} else {
+		previous.next = created
+	}
+
+	return created
+}
+
+// closeUpvalues moves the values of the stack slots from last up into their upvalues.
+func (vm *VM) closeUpvalues(last int) {
+	for vm.openUpvalues != nil && vm.openUpvalues.slot >= last {
+		upvalue := vm.openUpvalues
+		upvalue.closed = vm.stack[upvalue.slot]
+		upvalue.open = false
+		vm.openUpvalues = upvalue.next
+	}
+}
@@ -0,0 +1,67 @@
+package lox
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/fiurgeist/golox/internal/interpreter"
+	"github.com/fiurgeist/golox/internal/reporter"
+)
+
+// Errors wrapped by a RuntimeError if a limit is exceeded, these can't be caught by scripts.
+var (
+	ErrStepLimit = interpreter.ErrStepLimit
+	ErrTimeout   = interpreter.ErrTimeout
+	ErrCancelled = interpreter.ErrCancelled
+)
+
+// Diagnostic describes an error or a warning with its location.
+type Diagnostic = reporter.Diagnostic
+
+// StackFrame is an entry of the call stack of a RuntimeError.
+type StackFrame = reporter.StackFrame
+
+// CompileError is returned if the source has lexing, parse or resolve errors, nothing is run then.
+type CompileError struct {
+	Diagnostics []Diagnostic
+}
+
+func (e *CompileError) Error() string {
+	messages := make([]string, len(e.Diagnostics))
+	for i, diagnostic := range e.Diagnostics {
+		messages[i] = location(diagnostic) + diagnostic.Message
+	}
+
+	return strings.Join(messages, "\n")
+}
+
+// RuntimeError is returned for runtime errors, uncaught exceptions and exceeded limits.
+type RuntimeError struct {
+	Diagnostic
+	err error
+}
+
+func (e *RuntimeError) Error() string {
+	return location(e.Diagnostic) + e.Message
+}
+
+// Unwrap returns ErrStepLimit, ErrTimeout or ErrCancelled if a limit was exceeded.
+func (e *RuntimeError) Unwrap() error {
+	if e.err == interpreter.ErrRuntime {
+		return nil
+	}
+
+	return e.err
+}
+
+func location(diagnostic Diagnostic) string {
+	if diagnostic.Line == 0 {
+		return "" // raised outside of any source, like calling a non-function from Go
+	}
+
+	if diagnostic.File == "" {
+		return fmt.Sprintf("[line %d:%d] ", diagnostic.Line, diagnostic.Column)
+	}
+
+	return fmt.Sprintf("%s:%d:%d: ", diagnostic.File, diagnostic.Line, diagnostic.Column)
+}
@@ -0,0 +1,118 @@
+package lox_test
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/fiurgeist/golox/pkg/lox"
+)
+
+func ExampleRuntime_Eval() {
+	runtime := lox.New()
+
+	// globals are kept between evaluations
+	if _, err := runtime.Eval(`var greeting = "Hello";`); err != nil {
+		panic(err)
+	}
+
+	value, err := runtime.Eval(`greeting + " Lox"`)
+	fmt.Println(value, err)
+	// Output: Hello Lox <nil>
+}
+
+func ExampleRuntime_Call() {
+	runtime := lox.New()
+
+	if _, err := runtime.Eval(`fun add(a, b) { return a + b; }`); err != nil {
+		panic(err)
+	}
+
+	sum, err := runtime.Call("add", 1, 2)
+	fmt.Println(sum, err)
+
+	_, err = runtime.Call("add", "1", 2)
+	fmt.Println(err)
+	// Output:
+	// 3 <nil>
+	// [line 1:26] Operands must be two numbers or two strings, got 'string' and 'number'
+}
+
+func ExampleRuntime_Register() {
+	runtime := lox.New()
+	runtime.Register("greet", 1, func(arguments []interface{}) (interface{}, error) {
+		return fmt.Sprintf("Hello %s!", arguments[0]), nil
+	})
+
+	value, err := runtime.Eval(`greet("Lox")`)
+	fmt.Println(value, err)
+	// Output: Hello Lox! <nil>
+}
+
+func ExampleWithMaxSteps() {
+	runtime := lox.New(lox.WithMaxSteps(1000))
+
+	_, err := runtime.Eval(`while (true) {}`)
+	fmt.Println(err)
+	fmt.Println(errors.Is(err, lox.ErrStepLimit))
+	// Output:
+	// [line 1:8] Step limit of 1000 exceeded
+	// true
+}
+
+func ExampleRuntime_RegisterFunc() {
+	runtime := lox.New()
+
+	err := runtime.RegisterFunc("repeat", func(s string, times int) (string, error) {
+		if times < 0 {
+			return "", errors.New("negative count")
+		}
+		return strings.Repeat(s, times), nil
+	})
+	if err != nil {
+		panic(err)
+	}
+
+	value, err := runtime.Eval(`repeat("ab", 2)`)
+	fmt.Println(value, err)
+
+	_, err = runtime.Eval(`repeat("ab", 1.5)`)
+	fmt.Println(err)
+	// Output:
+	// abab <nil>
+	// [line 1:17] Argument 2: 1.5 doesn't fit into int
+}
+
+func ExampleDecode() {
+	runtime := lox.New()
+
+	value, err := runtime.Eval(`{"a": [1, 2], "b": [3]}`)
+	if err != nil {
+		panic(err)
+	}
+
+	var decoded map[string][]int
+	err = lox.Decode(value, &decoded)
+	fmt.Println(decoded, err)
+	// Output: map[a:[1 2] b:[3]] <nil>
+}
+
+func ExampleRuntime_Set() {
+	type Point struct{ X, Y int }
+	type Shape struct {
+		Name   string
+		Origin Point
+	}
+
+	runtime := lox.New()
+
+	// a pointer shares the struct, including its nested structs
+	shape := &Shape{Name: "square"}
+	if err := runtime.Set("shape", shape); err != nil {
+		panic(err)
+	}
+
+	_, err := runtime.Eval(`shape.Origin.X = 3;`)
+	fmt.Println(shape.Origin, err)
+	// Output: {3 0} <nil>
+}
@@ -0,0 +1,312 @@
+// Package lox embeds the Lox interpreter in Go programs.
+//
+//	runtime := lox.New()
+//	runtime.Register("greet", 1, func(arguments []interface{}) (interface{}, error) {
+//		return fmt.Sprintf("Hello %s!", arguments[0]), nil
+//	})
+//	value, err := runtime.Eval(`greet("Lox")`)
+//
+// Lox values are represented in Go as nil, bool, float64 and string, all other values like
+// lists, maps, functions and instances are opaque, Decode converts them to Go types.
+// Go values passed to the runtime are converted: numbers to float64, slices and arrays to lists,
+// maps to maps, structs to objects with their exported fields and methods as properties and
+// functions to natives, see RegisterFunc. Objects of pointers to structs share the struct with
+// Go, including structs nested in its fields.
+package lox
+
+import (
+	"context"
+	"io"
+	"os"
+	"time"
+
+	"github.com/fiurgeist/golox/internal/ast/stmt"
+	"github.com/fiurgeist/golox/internal/interpreter"
+	"github.com/fiurgeist/golox/internal/lexer"
+	"github.com/fiurgeist/golox/internal/parser"
+	"github.com/fiurgeist/golox/internal/reporter"
+	"github.com/fiurgeist/golox/internal/resolver"
+	"github.com/fiurgeist/golox/internal/token"
+)
+
+// Runtime keeps the global variables between evaluations, it must not be used concurrently.
+type Runtime struct {
+	globals            *interpreter.Environment
+	interpreter        interpreter.Interpreter
+	collector          *reporter.Collector
+	interpreterOptions []interpreter.Option
+	resolverOptions    []resolver.Option
+	warnings           []Diagnostic
+	running            int // nested runs and calls, like a native calling back into Lox
+}
+
+type Option func(*Runtime)
+
+// WithOutput redirects print statements, which write to stdout by default.
+func WithOutput(output io.Writer) Option {
+	return func(r *Runtime) {
+		r.interpreterOptions = append(r.interpreterOptions, interpreter.WithOutput(output))
+	}
+}
+
+// WithArgs sets the list returned by the args() native.
+func WithArgs(args []string) Option {
+	return func(r *Runtime) {
+		r.interpreterOptions = append(r.interpreterOptions, interpreter.WithArgs(args))
+	}
+}
+
+// WithMaxCallDepth limits the number of nested calls before a stack overflow is reported. Calls
+// nesting too many expressions report it earlier, before the Go stack would overflow.
+func WithMaxCallDepth(depth int) Option {
+	return func(r *Runtime) {
+		r.interpreterOptions = append(r.interpreterOptions, interpreter.WithMaxCallDepth(depth))
+	}
+}
+
+// WithMaxSteps limits the number of statements and expressions each Eval, RunFile or Call may
+// run, a RuntimeError wrapping ErrStepLimit is returned if it is exceeded.
+func WithMaxSteps(steps int) Option {
+	return func(r *Runtime) {
+		r.interpreterOptions = append(r.interpreterOptions, interpreter.WithMaxSteps(steps))
+	}
+}
+
+// WithTimeout limits the time each Eval, RunFile or Call may take, a RuntimeError wrapping
+// ErrTimeout is returned if it is exceeded.
+func WithTimeout(timeout time.Duration) Option {
+	return func(r *Runtime) {
+		r.interpreterOptions = append(r.interpreterOptions, interpreter.WithTimeout(timeout))
+	}
+}
+
+// WithMaxAllocation limits the approximate number of bytes each Eval, RunFile or Call may allocate
+// in total. It's a budget, memory that is garbage collected again isn't given back, so it also
+// stops long running scripts whose memory in use stays small. Exceeding it is a runtime error
+// scripts can catch.
+func WithMaxAllocation(bytes int) Option {
+	return func(r *Runtime) {
+		r.interpreterOptions = append(r.interpreterOptions, interpreter.WithMaxAllocation(bytes))
+	}
+}
+
+// WithContext stops any execution once the context is done, a RuntimeError wrapping
+// ErrCancelled is returned then.
+func WithContext(ctx context.Context) Option {
+	return func(r *Runtime) {
+		r.interpreterOptions = append(r.interpreterOptions, interpreter.WithContext(ctx))
+	}
+}
+
+// WithWarningsAsErrors fails on warnings like unused local variables.
+func WithWarningsAsErrors() Option {
+	return func(r *Runtime) {
+		r.resolverOptions = append(r.resolverOptions, resolver.WithWarningsAsErrors())
+	}
+}
+
+func New(options ...Option) *Runtime {
+	runtime := &Runtime{
+		globals:   interpreter.NewEnvironment(),
+		collector: reporter.NewCollector(),
+	}
+
+	for _, option := range options {
+		option(runtime)
+	}
+
+	runtime.interpreter = interpreter.NewInterpreter(
+		runtime.globals,
+		runtime.collector,
+		append(runtime.interpreterOptions, interpreter.WithResolverOptions(runtime.resolverOptions...))...,
+	)
+
+	return runtime
+}
+
+// Eval runs the source code. If it is a single expression, its value is returned, its trailing
+// ';' can be omitted then. Relative imports are resolved against the working directory.
+func (r *Runtime) Eval(source string) (interface{}, error) {
+	return r.run(&token.Source{Code: []byte(source)})
+}
+
+// RunFile runs the script at path, relative imports are resolved against its directory.
+func (r *Runtime) RunFile(path string) error {
+	code, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.run(&token.Source{Path: path, Code: code})
+	return err
+}
+
+// Get returns the value of a global variable.
+func (r *Runtime) Get(name string) (interface{}, bool) {
+	return r.globals.Get(name)
+}
+
+// Set defines or overwrites a global variable with the converted Go value.
+func (r *Runtime) Set(name string, value interface{}) error {
+	converted, err := interpreter.ToLox(value)
+	if err != nil {
+		return err
+	}
+
+	r.globals.Define(name, converted)
+	return nil
+}
+
+// Call calls the function, class or native stored in the global variable with the given name.
+func (r *Runtime) Call(name string, arguments ...interface{}) (interface{}, error) {
+	callee, ok := r.globals.Get(name)
+	if !ok {
+		return nil, &RuntimeError{Diagnostic: Diagnostic{
+			Phase:    reporter.PhaseRuntime,
+			Severity: reporter.SeverityError,
+			Message:  "Undefined variable '" + name + "'",
+		}}
+	}
+
+	return r.CallValue(callee, arguments...)
+}
+
+// CallValue calls a function, class or native value, like one returned by Get or Eval.
+func (r *Runtime) CallValue(callee interface{}, arguments ...interface{}) (interface{}, error) {
+	defer r.enter()()
+
+	values := make([]interface{}, len(arguments))
+	for i, argument := range arguments {
+		value, err := interpreter.ToLox(argument)
+		if err != nil {
+			return nil, err
+		}
+		values[i] = value
+	}
+
+	result, err := r.interpreter.Call(callee, values)
+	if err != nil {
+		return nil, r.runtimeError(err)
+	}
+
+	return result, nil
+}
+
+// Register defines a global native function with a fixed number of parameters.
+// An error returned by the function or a panic is raised as runtime error, which scripts can catch.
+func (r *Runtime) Register(name string, arity int, function Function) {
+	r.globals.Define(name, &native{arity: arity, function: function})
+}
+
+// RegisterFunc defines a global native calling any Go function with a fixed number of
+// parameters, returning nothing, a value, an error or a value and an error. The arguments and
+// the result are converted, a returned error or a panic is raised as runtime error.
+func (r *Runtime) RegisterFunc(name string, function interface{}) error {
+	native, err := interpreter.NewGoFunction(function)
+	if err != nil {
+		return err
+	}
+
+	r.globals.Define(name, native)
+	return nil
+}
+
+// Decode converts a Lox value to the Go type target points to. Lists can be decoded into slices
+// and arrays, maps into maps and objects created from Go structs into their struct or a pointer
+// to it. Into an empty interface, lists become []interface{} and maps map[interface{}]interface{}.
+func Decode(value interface{}, target interface{}) error {
+	return interpreter.FromLox(value, target)
+}
+
+// Warnings returns the warnings of the last Eval or RunFile.
+func (r *Runtime) Warnings() []Diagnostic {
+	return r.warnings
+}
+
+func (r *Runtime) run(source *token.Source) (interface{}, error) {
+	defer r.enter()()
+	if r.running == 1 {
+		r.warnings = nil
+	}
+	r.interpreter.SetPath(source.Path)
+
+	lexer := lexer.NewLexer(source, r.collector)
+	tokens, errLex := lexer.ScanTokens()
+
+	if errLex == nil {
+		// a single expression is evaluated to return its value
+		parser := parser.NewParser(tokens, reporter.NewCollector())
+		if expression, err := parser.ParseExpression(); err == nil {
+			if err := r.resolve([]stmt.Stmt{stmt.NewExpression(expression)}); err != nil {
+				return nil, err
+			}
+
+			value, err := r.interpreter.Evaluate(expression)
+			if err != nil {
+				return nil, r.runtimeError(err)
+			}
+
+			return value, nil
+		}
+	}
+
+	parser := parser.NewParser(tokens, r.collector)
+	statements, errParse := parser.Parse()
+	if errLex != nil || errParse != nil {
+		return nil, r.compileError()
+	}
+
+	if err := r.resolve(statements); err != nil {
+		return nil, err
+	}
+
+	if err := r.interpreter.Interpret(statements); err != nil {
+		return nil, r.runtimeError(err)
+	}
+
+	return nil, nil
+}
+
+// enter starts a run or a call, the outermost one starts without the diagnostics of the previous
+// one. The returned function ends it.
+func (r *Runtime) enter() func() {
+	if r.running == 0 {
+		r.collector.Reset()
+	}
+	r.running++
+
+	return func() { r.running-- }
+}
+
+func (r *Runtime) resolve(statements []stmt.Stmt) error {
+	resolver := resolver.NewResolver(r.collector, r.resolverOptions...)
+	err := resolver.Resolve(statements)
+
+	for _, diagnostic := range r.collector.Diagnostics {
+		if diagnostic.Severity == reporter.SeverityWarning {
+			r.warnings = append(r.warnings, diagnostic)
+		}
+	}
+
+	if err != nil {
+		return r.compileError()
+	}
+
+	return nil
+}
+
+func (r *Runtime) compileError() error {
+	err := &CompileError{}
+	for _, diagnostic := range r.collector.Diagnostics {
+		if diagnostic.Severity == reporter.SeverityError {
+			err.Diagnostics = append(err.Diagnostics, diagnostic)
+		}
+	}
+
+	return err
+}
+
+// runtimeError is the last diagnostic, as a runtime error stops the execution.
+func (r *Runtime) runtimeError(err error) error {
+	return &RuntimeError{Diagnostic: r.collector.Diagnostics[len(r.collector.Diagnostics)-1], err: err}
+}
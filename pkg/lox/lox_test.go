@@ -0,0 +1,211 @@
+package lox_test
+
+import (
+	"errors"
+	goruntime "runtime"
+	"strings"
+	"testing"
+
+	"github.com/fiurgeist/golox/pkg/lox"
+)
+
+func TestNativePanic(t *testing.T) {
+	runtime := lox.New()
+	if err := runtime.RegisterFunc("boom", func(xs []int) int { return xs[5] }); err != nil {
+		t.Fatal(err)
+	}
+	runtime.Register("fail", 0, func(arguments []interface{}) (interface{}, error) {
+		panic("failed")
+	})
+
+	tests := []struct {
+		code string
+		want string
+	}{
+		{code: "print boom([1]);", want: "[line 1:15] Go panic: runtime error: index out of range [5] with length 1"},
+		{code: "fail();", want: "[line 1:6] Go panic: failed"},
+	}
+
+	for _, test := range tests {
+		_, err := runtime.Eval(test.code)
+
+		var runtimeError *lox.RuntimeError
+		if !errors.As(err, &runtimeError) || err.Error() != test.want {
+			t.Errorf("Eval(%q) = %v, want a RuntimeError %q", test.code, err, test.want)
+		}
+	}
+
+	var output strings.Builder
+	caught := lox.New(lox.WithOutput(&output))
+	caught.Register("fail", 0, func(arguments []interface{}) (interface{}, error) {
+		panic("failed")
+	})
+	if _, err := caught.Eval(`try { fail(); } catch (e) { print e.message; }`); err != nil || output.String() != "Go panic: failed\n" {
+		t.Errorf("catching the panic printed %q and returned %v", output.String(), err)
+	}
+
+	// the runtime stays usable, without the frames of the panicking call in stack traces
+	runtime.Eval(`fun outer() { return fail(); }`)
+	_, err := runtime.Call("outer")
+
+	var runtimeError *lox.RuntimeError
+	if !errors.As(err, &runtimeError) || len(runtimeError.Trace) != 2 {
+		t.Errorf("Call(outer) = %#v, want a RuntimeError with the frames outer and the script", err)
+	}
+}
+
+type inner struct{ X float64 }
+
+type outer struct {
+	*inner
+	Name string
+}
+
+func TestNilEmbeddedStruct(t *testing.T) {
+	runtime := lox.New()
+	if err := runtime.Set("o", &outer{Name: "o"}); err != nil {
+		t.Fatal(err)
+	}
+
+	want := "[line 1:3] Property 'X': reflect: indirection through nil pointer to embedded struct field inner"
+	for _, code := range []string{"o.X;", "o.X = 1;"} {
+		_, err := runtime.Eval(code)
+
+		var runtimeError *lox.RuntimeError
+		if !errors.As(err, &runtimeError) || err.Error() != want {
+			t.Errorf("Eval(%q) = %v, want a RuntimeError %q", code, err, want)
+		}
+	}
+
+	// the fields of the outer struct are still accessible
+	if value, err := runtime.Eval("o.Name"); err != nil || value != "o" {
+		t.Errorf("Eval(o.Name) = %v, %v", value, err)
+	}
+}
+
+func TestInterpolationAllocationLimit(t *testing.T) {
+	runtime := lox.New(lox.WithMaxAllocation(1 << 10))
+	if err := runtime.Set("s", strings.Repeat("x", 1<<20)); err != nil {
+		t.Fatal(err)
+	}
+
+	var before, after goruntime.MemStats
+	goruntime.ReadMemStats(&before)
+	_, err := runtime.Eval(`"${s}${s}${s}${s}${s}${s}${s}${s}"`)
+	goruntime.ReadMemStats(&after)
+
+	if err == nil || err.Error() != "[line 1:4] Allocation limit of 1024 bytes exceeded" {
+		t.Errorf("Eval = %v, want the allocation limit exceeded", err)
+	}
+
+	// the 8 MB string mustn't be built before the limit is checked
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > 1<<20 {
+		t.Errorf("allocated %d bytes", allocated)
+	}
+}
+
+func TestStackOverflow(t *testing.T) {
+	// far more calls than fit on the Go stack with nested expressions in each of them
+	runtime := lox.New(lox.WithMaxCallDepth(1000000))
+	code := "fun r(n) { return " + strings.Repeat("1 + (", 8) + "r(n)" + strings.Repeat(")", 8) + "; } r(0);"
+
+	_, err := runtime.Eval(code)
+
+	var runtimeError *lox.RuntimeError
+	if !errors.As(err, &runtimeError) || runtimeError.Message != "Stack overflow" {
+		t.Errorf("Eval = %v, want a RuntimeError Stack overflow", err)
+	}
+}
+
+func TestRethrownRuntimeError(t *testing.T) {
+	runtime := lox.New()
+	runtime.Eval(`fun fail() { return nil.x; }`)
+
+	tests := []string{
+		`fun f() { try { fail(); } finally {} } f();`,
+		`fun f() { try { fail(); } catch (e) { throw e; } } f();`,
+	}
+
+	for _, code := range tests {
+		_, err := runtime.Eval(code)
+
+		// with the frames fail, f and the script
+		var runtimeError *lox.RuntimeError
+		if !errors.As(err, &runtimeError) || runtimeError.Message != "'nil' is not an instance" || len(runtimeError.Trace) != 3 {
+			t.Errorf("Eval(%q) = %#v, want the RuntimeError of fail with its stack trace", code, err)
+		}
+	}
+}
+
+func TestReentrantRuntimeError(t *testing.T) {
+	var output strings.Builder
+	runtime := lox.New(lox.WithOutput(&output))
+	runtime.Register("callBad", 0, func(arguments []interface{}) (interface{}, error) {
+		return runtime.Call("bad")
+	})
+	if _, err := runtime.Eval(`fun bad() { return undefined; }`); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := runtime.Eval(`
+fun f() { return callBad(); }
+try { f(); } catch (e) { print e.message; }
+f();`)
+
+	// raised at the call of the native in f, which the script calls at line 4
+	want := "[line 2:26] [line 1:20] Undefined variable 'undefined'"
+	var runtimeError *lox.RuntimeError
+	if !errors.As(err, &runtimeError) || err.Error() != want || len(runtimeError.Trace) != 2 || runtimeError.Trace[1].Line != 4 {
+		t.Errorf("Eval = %#v, want a RuntimeError %q in f called at line 4", err, want)
+	}
+
+	if want := "[line 1:20] Undefined variable 'undefined'\n"; output.String() != want {
+		t.Errorf("printed %q, want %q", output.String(), want)
+	}
+}
+
+func TestCyclicValue(t *testing.T) {
+	runtime := lox.New()
+	if err := runtime.RegisterFunc("count", func(xs []interface{}) int { return len(xs) }); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := runtime.Eval(`var l = [1]; push(l, l); var m = {}; m["m"] = m;`); err != nil {
+		t.Fatal(err)
+	}
+
+	list, _ := runtime.Get("l")
+	if err := lox.Decode(list, &[]interface{}{}); err == nil || err.Error() != "cyclic value can't be converted" {
+		t.Errorf("Decode(list) = %v, want the cyclic value error", err)
+	}
+
+	m, _ := runtime.Get("m")
+	if err := lox.Decode(m, &map[string]interface{}{}); err == nil || err.Error() != "cyclic value can't be converted" {
+		t.Errorf("Decode(map) = %v, want the cyclic value error", err)
+	}
+
+	if _, err := runtime.Eval(`count(l)`); err == nil || !strings.HasSuffix(err.Error(), "cyclic value can't be converted") {
+		t.Errorf("Eval(count(l)) = %v, want the cyclic value error", err)
+	}
+
+	// shared values aren't cyclic
+	if _, err := runtime.Eval(`var shared = [1]; count([shared, shared]);`); err != nil {
+		t.Errorf("Eval(count([shared, shared])) = %v", err)
+	}
+
+	goList := []interface{}{1, nil}
+	goList[1] = goList
+	goMap := map[string]interface{}{}
+	goMap["m"] = goMap
+
+	for _, value := range []interface{}{goList, goMap} {
+		if err := runtime.Set("v", value); err == nil || err.Error() != "cyclic value can't be converted" {
+			t.Errorf("Set(%T) = %v, want the cyclic value error", value, err)
+		}
+	}
+
+	goShared := []int{1}
+	if err := runtime.Set("v", [][]int{goShared, goShared}); err != nil {
+		t.Errorf("Set(shared slices) = %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+package lox
+
+import (
+	"github.com/fiurgeist/golox/internal/interpreter"
+	"github.com/fiurgeist/golox/internal/token"
+)
+
+// Function is a Go function callable from Lox, see Runtime.Register.
+type Function func(arguments []interface{}) (interface{}, error)
+
+var _ interpreter.Callable = (*native)(nil)
+
+type native struct {
+	arity    int
+	function Function
+}
+
+func (c *native) Call(i *interpreter.Interpreter, paren token.Token, arguments []interface{}) interface{} {
+	defer interpreter.RecoverGoPanic(paren)
+
+	result, err := c.function(arguments)
+	if err != nil {
+		panic(interpreter.NewRuntimeError(paren, err.Error()))
+	}
+
+	value, err := interpreter.ToLox(result)
+	if err != nil {
+		panic(interpreter.NewRuntimeError(paren, err.Error()))
+	}
+
+	return value
+}
+
+func (c *native) Arity() int {
+	return c.arity
+}
+
+func (c *native) String() string {
+	return "<native fn>"
+}